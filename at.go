@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// reportAt prints the metrics declared by the call spanning a line,
+// given as file.go:line, or else the metrics declared in the function
+// around it. It returns the exit status: 1 when there are none.
+func reportAt(at string) int {
+	i := strings.LastIndex(at, ":")
+	if i < 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "invalid location %q, expected file.go:line\n", at)
+		return 2
+	}
+	path := filepath.Clean(at[:i])
+	line, err := strconv.Atoi(at[i+1:])
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "invalid location %q, expected file.go:line\n", at)
+		return 2
+	}
+
+	hits, err := fileDeclarations(path)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	var found byScore
+	for _, hit := range hits {
+		if hit.line <= line && line <= hit.endLine {
+			found = append(found, hit)
+		}
+	}
+	if len(found) == 0 {
+		start, end, err := enclosingFunc(path, line)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		for _, hit := range hits {
+			if start <= hit.line && hit.line <= end {
+				found = append(found, hit)
+			}
+		}
+	}
+
+	sortHits(found, "line")
+	absPaths(found)
+	for _, hit := range found {
+		printHit(hit)
+	}
+	if len(found) == 0 {
+		return 1
+	}
+	return 0
+}
+
+// fileDeclarations returns the metrics declared in a file. The other
+// files of its package are parsed too, to resolve the constants they
+// declare.
+func fileDeclarations(path string) (byScore, error) {
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{path}
+	for _, entry := range entries {
+		name := filepath.Join(filepath.Dir(path), entry.Name())
+		if entry.IsDir() || filepath.Ext(name) != ".go" || name == path || (isTestFile(name) && !isTestFile(path)) {
+			continue
+		}
+		paths = append(paths, name)
+	}
+
+	var accum, hits byScore
+	if err := process(paths, &matchAny{}, &accum); err != nil {
+		return nil, err
+	}
+	for _, hit := range accum {
+		if hit.path == path {
+			hits = append(hits, hit)
+		}
+	}
+	return hits, nil
+}
+
+// enclosingFunc returns the lines of the function declared around a
+// line of a file, or 0, 0 when there is none.
+func enclosingFunc(path string, line int) (start, end int, err error) {
+	fset := token.NewFileSet()
+	tree, err := parser.ParseFile(fset, path, nil, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, decl := range tree.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		start, end = fset.Position(fd.Pos()).Line, fset.Position(fd.End()).Line
+		if start <= line && line <= end {
+			return start, end, nil
+		}
+	}
+	return 0, 0, nil
+}
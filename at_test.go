@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReportAt(t *testing.T) {
+	dir := t.TempDir()
+	for name, src := range map[string]string{
+		"m.go": `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var requests = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "requests_total",
+	Help:      "Requests served.",
+})
+
+func newMetrics() {
+	_ = prometheus.NewGauge(prometheus.GaugeOpts{Name: "queue_length"})
+
+	_ = prometheus.NewHistogram(prometheus.HistogramOpts{Name: "latency_seconds"})
+}
+
+func noMetrics() {}
+`,
+		"const.go": `package m
+
+const namespace = "src"
+`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+
+	for _, tt := range []struct {
+		at     string
+		want   []string
+		status int
+	}{
+		{"m.go:7", []string{"m.go:5 (var requests)    src_requests_total Counter: Requests served."}, 0},
+		{"./m.go:5", []string{"m.go:5 (var requests)    src_requests_total Counter"}, 0},
+		{"m.go:13", []string{"m.go:12 (in newMetrics)    queue_length Gauge", "m.go:14 (in newMetrics)    latency_seconds Histogram"}, 0},
+		{"m.go:17", nil, 1},
+		{"m.go", nil, 2},
+		{"missing.go:1", nil, 2},
+	} {
+		status := -1
+		out := captureStdout(t, func() {
+			status = reportAt(tt.at)
+		})
+		for _, want := range tt.want {
+			if !strings.Contains(out, want) {
+				t.Errorf("--at %s printed\n%s\nwant %q", tt.at, out, want)
+			}
+		}
+		if lines := strings.Count(out, "\n"); lines != len(tt.want) {
+			t.Errorf("--at %s printed %d lines, want %d", tt.at, lines, len(tt.want))
+		}
+		if status != tt.status {
+			t.Errorf("--at %s exited with %d, want %d", tt.at, status, tt.status)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"math"
+)
+
+// defBuckets mirrors prometheus.DefBuckets.
+var defBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// histogramBuckets returns the evaluated buckets of a histogram hit. A
+// client_golang histogram leaving Buckets unset, and not configured as
+// a native histogram, has the default buckets, and def is then true.
+func histogramBuckets(hit matchResult) (buckets []float64, def bool) {
+	if hit.kind != histogram || hit.buckets != nil || hit.bucketsExpr != "" {
+		return hit.buckets, false
+	}
+	if hit.opts["NativeHistogramBucketFactor"] != "" {
+		return nil, false
+	}
+	for _, reg := range hit.registrations {
+		if reg.auto == "VictoriaMetrics" {
+			return nil, false
+		}
+	}
+	return defBuckets, true
+}
+
+// getBuckets evaluates the Buckets of a histogram. When the expression
+// cannot be evaluated statically, its source text is returned instead.
+func getBuckets(c *ast.CallExpr, fi *fileInfo) ([]float64, string) {
+	expr := optsField(c, "Buckets", fi)
+	if expr == nil {
+		return nil, ""
+	}
+
+	switch e := expr.(type) {
+	case *ast.CompositeLit:
+		buckets := make([]float64, 0, len(e.Elts))
+		for _, el := range e.Elts {
+			v, ok := constFloat(el)
+			if !ok {
+				return nil, types.ExprString(expr)
+			}
+			buckets = append(buckets, v)
+		}
+		return buckets, ""
+	case *ast.CallExpr:
+		if len(e.Args) != 3 {
+			break
+		}
+		var args [3]float64
+		for i, arg := range e.Args {
+			v, ok := constFloat(arg)
+			if !ok {
+				return nil, types.ExprString(expr)
+			}
+			args[i] = v
+		}
+		if buckets := evalBuckets(getCallExprLiteral(e, fi), args[0], args[1], int(args[2])); buckets != nil {
+			return buckets, ""
+		}
+	default:
+		if getSelectorLiteral(expr, fi) == "prometheus.DefBuckets" {
+			return defBuckets, ""
+		}
+	}
+	return nil, types.ExprString(expr)
+}
+
+// evalBuckets computes the result of the prometheus bucket helpers, or
+// nil if fn is not one or its arguments would make it panic.
+func evalBuckets(fn string, a, b float64, count int) []float64 {
+	if count < 1 {
+		return nil
+	}
+	buckets := make([]float64, count)
+	switch fn {
+	case "prometheus.LinearBuckets":
+		for i := range buckets {
+			buckets[i] = a + float64(i)*b
+		}
+	case "prometheus.ExponentialBuckets":
+		if a <= 0 || b <= 1 {
+			return nil
+		}
+		for i := range buckets {
+			buckets[i] = a
+			a *= b
+		}
+	case "prometheus.ExponentialBucketsRange":
+		if a <= 0 || b <= a || count < 2 {
+			return nil
+		}
+		factor := math.Pow(b/a, 1/float64(count-1))
+		for i := range buckets {
+			buckets[i] = a * math.Pow(factor, float64(i))
+		}
+	default:
+		return nil
+	}
+	return buckets
+}
+
+// constFloat evaluates a numeric literal, optionally negated or
+// parenthesized.
+func constFloat(expr ast.Expr) (float64, bool) {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		if e.Kind != token.INT && e.Kind != token.FLOAT {
+			return 0, false
+		}
+		v, _ := constant.Float64Val(constant.MakeFromLiteral(e.Value, e.Kind, 0))
+		return v, true
+	case *ast.UnaryExpr:
+		v, ok := constFloat(e.X)
+		if !ok || (e.Op != token.SUB && e.Op != token.ADD) {
+			return 0, false
+		}
+		if e.Op == token.SUB {
+			v = -v
+		}
+		return v, true
+	case *ast.ParenExpr:
+		return constFloat(e.X)
+	}
+	return 0, false
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBuckets(t *testing.T) {
+	hits := scanOne(t, `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	a = prometheus.NewHistogram(prometheus.HistogramOpts{Name: "a_seconds", Buckets: prometheus.ExponentialBuckets(0.5, 2, 4)})
+	b = prometheus.NewHistogram(prometheus.HistogramOpts{Name: "b_seconds", Buckets: prometheus.LinearBuckets(-1, 0.5, 3)})
+	c = prometheus.NewHistogram(prometheus.HistogramOpts{Name: "c_seconds", Buckets: []float64{.1, 1, 10}})
+	d = prometheus.NewHistogram(prometheus.HistogramOpts{Name: "d_seconds", Buckets: prometheus.DefBuckets})
+	e = prometheus.NewHistogram(prometheus.HistogramOpts{Name: "e_seconds", Buckets: latencyBuckets})
+	f = prometheus.NewHistogram(prometheus.HistogramOpts{Name: "f_seconds", Buckets: prometheus.ExponentialBuckets(1, 2, n)})
+	g = prometheus.NewHistogram(prometheus.HistogramOpts{Name: "g_seconds"})
+)
+`)
+	want := map[string]string{
+		"a_seconds": "[0.5 1 2 4]",
+		"b_seconds": "[-1 -0.5 0]",
+		"c_seconds": "[0.1 1 10]",
+		"d_seconds": fmt.Sprint(defBuckets),
+		"e_seconds": "latencyBuckets",
+		"f_seconds": "prometheus.ExponentialBuckets(1, 2, n)",
+		"g_seconds": "",
+	}
+	if len(hits) != len(want) {
+		t.Fatalf("got %v, want %d histograms", names(hits), len(want))
+	}
+	for _, hit := range hits {
+		got := hit.bucketsExpr
+		if hit.buckets != nil {
+			got = fmt.Sprint(hit.buckets)
+		}
+		if got != want[hit.val] {
+			t.Errorf("%s buckets %s, want %s", hit.val, got, want[hit.val])
+		}
+	}
+}
+
+func TestEvalBuckets(t *testing.T) {
+	for _, tt := range []struct {
+		fn    string
+		a, b  float64
+		count int
+		want  string
+	}{
+		{"prometheus.LinearBuckets", 1, 2, 3, "[1 3 5]"},
+		{"prometheus.ExponentialBuckets", 1, 10, 3, "[1 10 100]"},
+		{"prometheus.ExponentialBucketsRange", 1, 100, 3, "[1 10 100]"},
+		{"prometheus.ExponentialBuckets", 0, 2, 3, "[]"},
+		{"prometheus.ExponentialBucketsRange", 1, 100, 1, "[]"},
+		{"prometheus.LinearBuckets", 1, 2, 0, "[]"},
+		{"prometheus.Buckets", 1, 2, 3, "[]"},
+	} {
+		if got := fmt.Sprint(evalBuckets(tt.fn, tt.a, tt.b, tt.count)); got != tt.want {
+			t.Errorf("%s(%v, %v, %d) = %s, want %s", tt.fn, tt.a, tt.b, tt.count, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// builtinCollector describes a collector shipped with client_golang and
+// the well-known series families it exposes.
+type builtinCollector struct {
+	help   string
+	series []string
+}
+
+var goCollector = builtinCollector{
+	help: "Go runtime metrics",
+	series: []string{
+		"go_gc_duration_seconds",
+		"go_gc_gogc_percent",
+		"go_gc_gomemlimit_bytes",
+		"go_goroutines",
+		"go_info",
+		"go_memstats_alloc_bytes",
+		"go_memstats_alloc_bytes_total",
+		"go_memstats_buck_hash_sys_bytes",
+		"go_memstats_frees_total",
+		"go_memstats_gc_sys_bytes",
+		"go_memstats_heap_alloc_bytes",
+		"go_memstats_heap_idle_bytes",
+		"go_memstats_heap_inuse_bytes",
+		"go_memstats_heap_objects",
+		"go_memstats_heap_released_bytes",
+		"go_memstats_heap_sys_bytes",
+		"go_memstats_last_gc_time_seconds",
+		"go_memstats_lookups_total",
+		"go_memstats_mallocs_total",
+		"go_memstats_mcache_inuse_bytes",
+		"go_memstats_mcache_sys_bytes",
+		"go_memstats_mspan_inuse_bytes",
+		"go_memstats_mspan_sys_bytes",
+		"go_memstats_next_gc_bytes",
+		"go_memstats_other_sys_bytes",
+		"go_memstats_stack_inuse_bytes",
+		"go_memstats_stack_sys_bytes",
+		"go_memstats_sys_bytes",
+		"go_sched_gomaxprocs_threads",
+		"go_threads",
+	},
+}
+
+var processCollector = builtinCollector{
+	help: "Process metrics",
+	series: []string{
+		"process_cpu_seconds_total",
+		"process_max_fds",
+		"process_network_receive_bytes_total",
+		"process_network_transmit_bytes_total",
+		"process_open_fds",
+		"process_resident_memory_bytes",
+		"process_start_time_seconds",
+		"process_virtual_memory_bytes",
+		"process_virtual_memory_max_bytes",
+	},
+}
+
+var buildInfoCollector = builtinCollector{
+	help:   "Build information",
+	series: []string{"go_build_info"},
+}
+
+// builtinCollectors are the constructors of the collectors shipped with
+// client_golang.
+var builtinCollectors = map[string]builtinCollector{
+	"prometheus.NewGoCollector":        goCollector,
+	"prometheus.NewProcessCollector":   processCollector,
+	"prometheus.NewBuildInfoCollector": buildInfoCollector,
+	"collectors.NewGoCollector":        goCollector,
+	"collectors.NewProcessCollector":   processCollector,
+	"collectors.NewBuildInfoCollector": buildInfoCollector,
+}
+
+// inspectCollector reports a collector hit for a built-in collector
+// constructor. A query matches the collector through the best matching
+// of its series; without a query the series are listed in the help.
+func inspectCollector(bc builtinCollector, callExpr *ast.CallExpr, pos token.Position, fi *fileInfo, mr matcher, accum *byScore) {
+	namespace := ""
+	if len(callExpr.Args) == 2 {
+		// prometheus.NewProcessCollector(pid, namespace) of older releases.
+		namespace, _ = evalString(callExpr.Args[1], fi)
+	} else if cl := resolveOpts(firstArg(callExpr), fi); cl != nil {
+		for _, el := range cl.Elts {
+			kv, ok := el.(*ast.KeyValueExpr)
+			if ok && types.ExprString(kv.Key) == "Namespace" {
+				namespace, _ = evalString(kv.Value, fi)
+			}
+		}
+	}
+
+	series := make([]string, len(bc.series))
+	for i, s := range bc.series {
+		series[i] = s
+		if namespace != "" {
+			series[i] = namespace + "_" + s
+		}
+	}
+
+	var best matchResult
+	found := false
+	for _, s := range series {
+		hit, ok := mr.Match(promOpts{"Name": s, "Help": bc.help}, pos)
+		if ok && (!found || hit.score > best.score) {
+			best, found = hit, true
+		}
+	}
+	if !found {
+		return
+	}
+	if best.listed {
+		best.val = series[0]
+		if len(series) > 1 {
+			best.val = commonPrefix(series) + "*"
+		}
+		best.help = bc.help + ": " + strings.Join(series, ", ")
+	}
+	best.kind = collector
+	*accum = append(*accum, best)
+}
+
+// firstArg returns the first argument of a call, or nil.
+func firstArg(c *ast.CallExpr) ast.Expr {
+	if len(c.Args) == 0 {
+		return nil
+	}
+	return c.Args[0]
+}
+
+// commonPrefix returns the longest common prefix of names up to and
+// including an underscore, such as go_ for the Go collector series.
+func commonPrefix(names []string) string {
+	prefix := names[0]
+	for _, name := range names[1:] {
+		for !strings.HasPrefix(name, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix[:strings.LastIndex(prefix, "_")+1]
+}
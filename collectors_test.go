@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const collectorsSource = `package m
+
+import (
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+func init() {
+	prometheus.MustRegister(collectors.NewGoCollector())
+	prometheus.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{Namespace: "src"}))
+	prometheus.MustRegister(prometheus.NewProcessCollector(os.Getpid(), "legacy"))
+	collectors.NewBuildInfoCollector()
+}
+`
+
+func TestBuiltinCollectors(t *testing.T) {
+	hits := scanOne(t, collectorsSource)
+	want := []string{"go_*", "src_process_*", "legacy_process_*", "go_build_info"}
+	if got := names(hits); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for _, hit := range hits {
+		if hit.kind != collector || hit.kind.String() != "Collector" {
+			t.Errorf("%s is a %v, want a Collector", hit.val, hit.kind)
+		}
+	}
+	if !strings.HasPrefix(hits[1].help, "Process metrics: src_process_cpu_seconds_total, ") {
+		t.Errorf("help %q, want the series of the process collector", hits[1].help)
+	}
+	if got := formatRegistrations(hits[0].registrations); !strings.HasSuffix(got, "m.go:11") {
+		t.Errorf("go collector registered %s, want at line 11", got)
+	}
+	if got := formatRegistrations(hits[3].registrations); got != "unregistered" {
+		t.Errorf("build info collector registered %s, want unregistered", got)
+	}
+}
+
+func TestBuiltinCollectorsQuery(t *testing.T) {
+	for _, tt := range []struct {
+		query string
+		want  string
+		score int
+	}{
+		{"go_memstats_alloc_bytes", "go_memstats_alloc_bytes", 100},
+		{"src_process_open_fds", "src_process_open_fds", 100},
+		{"go_build", "go_build_info", 62},
+	} {
+		hits := scanSource(t, map[string]string{"m.go": collectorsSource}, &matchName{name: tt.query})
+		if len(hits) == 0 {
+			t.Errorf("%s found nothing, want %s", tt.query, tt.want)
+			continue
+		}
+		best := hits[0]
+		for _, hit := range hits[1:] {
+			if hit.score > best.score {
+				best = hit
+			}
+		}
+		if best.val != tt.want || best.score != tt.score || best.kind != collector {
+			t.Errorf("%s found %s %v with score %d, want the Collector %s with score %d", tt.query, best.val, best.kind, best.score, tt.want, tt.score)
+		}
+	}
+}
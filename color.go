@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SGR parameters of the colors used in the text output.
+const (
+	bold      = "1"
+	dim       = "2"
+	gray      = "90"
+	highlight = "1;33"
+)
+
+// kindColors are the colors of the kinds in the text output.
+var kindColors = map[metricKind]string{
+	counter:   "32",
+	gauge:     "36",
+	histogram: "35",
+	summary:   "34",
+}
+
+// isTerminal is set when the standard output is a terminal.
+var isTerminal = func() bool {
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}()
+
+// colorOutput is set when the text output is colored.
+var colorOutput = isTerminal && os.Getenv("NO_COLOR") == ""
+
+// setColor sets whether the output is colored from the value of --color.
+func setColor(mode string) error {
+	switch mode {
+	case "always":
+		colorOutput = true
+	case "never":
+		colorOutput = false
+	case "auto":
+		colorOutput = isTerminal && os.Getenv("NO_COLOR") == ""
+	default:
+		return fmt.Errorf("invalid color mode %q, expected always, never or auto", mode)
+	}
+	return nil
+}
+
+// colorize renders s with the SGR parameters when the output is colored.
+func colorize(sgr, s string) string {
+	if !colorOutput || sgr == "" || s == "" {
+		return s
+	}
+	return "\x1b[" + sgr + "m" + s + "\x1b[0m"
+}
+
+// colorName renders the name of a hit in bold, with the part the query
+// matched highlighted.
+func colorName(hit matchResult) string {
+	m := hit.matched
+	if len(m) != 2 || m[0] < 0 || m[0] >= m[1] || m[1] > len(hit.val) {
+		return colorize(bold, hit.val)
+	}
+	return colorize(bold, hit.val[:m[0]]) + colorize(highlight, hit.val[m[0]:m[1]]) + colorize(bold, hit.val[m[1]:])
+}
+
+// emphasize makes s stand out when printing to a terminal.
+func emphasize(s string) string {
+	return colorize(bold, s)
+}
+
+// emphasizeFragment emphasizes the first occurrence of fragment in s,
+// ignoring case.
+func emphasizeFragment(s, fragment string) string {
+	i := strings.Index(foldCase(s), foldCase(fragment))
+	if i < 0 {
+		return s
+	}
+	return s[:i] + emphasize(s[i:i+len(fragment)]) + s[i+len(fragment):]
+}
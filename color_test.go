@@ -0,0 +1,80 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestSetColor(t *testing.T) {
+	setFlag(t, &colorOutput, false)
+	for _, tt := range []struct {
+		mode string
+		want bool
+	}{
+		{"always", true},
+		{"never", false},
+		{"auto", isTerminal},
+	} {
+		t.Setenv("NO_COLOR", "")
+		if err := setColor(tt.mode); err != nil || colorOutput != tt.want {
+			t.Errorf("--color=%s colored %v (%v), want %v", tt.mode, colorOutput, err, tt.want)
+		}
+	}
+	t.Setenv("NO_COLOR", "1")
+	if err := setColor("auto"); err != nil || colorOutput {
+		t.Errorf("--color=auto colored with NO_COLOR set (%v)", err)
+	}
+	if err := setColor("sometimes"); err == nil {
+		t.Error("--color=sometimes is accepted")
+	}
+}
+
+func TestColorName(t *testing.T) {
+	setFlag(t, &colorOutput, true)
+	for _, tt := range []struct {
+		matched []int
+		want    string
+	}{
+		{nil, "\x1b[1msrc_requests_total\x1b[0m"},
+		{[]int{4, 12}, "\x1b[1msrc_\x1b[0m\x1b[1;33mrequests\x1b[0m\x1b[1m_total\x1b[0m"},
+		{[]int{0, 18}, "\x1b[1;33msrc_requests_total\x1b[0m"},
+		{[]int{4, 40}, "\x1b[1msrc_requests_total\x1b[0m"},
+	} {
+		hit := matchResult{val: "src_requests_total", matched: tt.matched}
+		if got := colorName(hit); got != tt.want {
+			t.Errorf("colorName() with %v = %q, want %q", tt.matched, got, tt.want)
+		}
+	}
+
+	setFlag(t, &colorOutput, false)
+	if got := colorName(matchResult{val: "up", matched: []int{0, 2}}); got != "up" {
+		t.Errorf("colorName() without colors = %q, want up", got)
+	}
+}
+
+func TestMatchedOffsets(t *testing.T) {
+	src := `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var c = prometheus.NewCounter(prometheus.CounterOpts{Namespace: "src", Subsystem: "http", Name: "requests_total"})
+`
+	for _, tt := range []struct {
+		mr   matcher
+		want string
+	}{
+		{&matchName{name: "http_requests"}, "http_requests"},
+		{&matchName{name: "_total", suffix: true}, "_total"},
+		{&matchName{name: "src_", prefix: true}, "src_"},
+		{&matchRegex{re: regexp.MustCompile(`req\w+s`)}, "requests"},
+	} {
+		hits := scanSource(t, map[string]string{"m.go": src}, tt.mr)
+		if len(hits) != 1 {
+			t.Fatalf("%#v found %v", tt.mr, names(hits))
+		}
+		hit := hits[0]
+		if m := hit.matched; len(m) != 2 || hit.val[m[0]:m[1]] != tt.want {
+			t.Errorf("%#v matched %v of %s, want %s", tt.mr, m, hit.val, tt.want)
+		}
+	}
+}
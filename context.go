@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// sourceLines caches the lines of the files printed with -C.
+var sourceLines = make(map[string][]string)
+
+// printSource prints the lines of the declaration of a hit with n lines
+// of context around them, numbered, and with the line of the hit marked.
+// The file is read again, so it may have changed since the scan; the
+// lines that are gone are skipped with a note. A file that cannot be
+// read is noted once and its hits are printed without their source.
+func printSource(hit matchResult, n int) {
+	lines, ok := sourceLines[hit.path]
+	if !ok {
+		data, err := os.ReadFile(hit.path)
+		if err != nil {
+			note("%v", err)
+		} else {
+			lines = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+		}
+		sourceLines[hit.path] = lines
+	}
+	if lines == nil {
+		return
+	}
+
+	start := max(hit.line-n, 1)
+	end := min(max(hit.endLine, hit.line)+n, len(lines))
+	width := len(fmt.Sprint(end))
+	for i := start; i <= end; i++ {
+		mark := " "
+		if i == hit.line {
+			mark = ">"
+		}
+		fmt.Printf("  %s %*d  %s\n", mark, width, i, lines[i-1])
+	}
+	if hit.line > len(lines) {
+		fmt.Printf("    (%s has changed: line %d is gone)\n", hit.path, hit.line)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrintSource(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "m.go")
+	if err := os.WriteFile(path, []byte("one\ntwo\nthree\nfour\nfive\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "gone.go")
+
+	for _, tt := range []struct {
+		name         string
+		hit          matchResult
+		n            int
+		want, stderr string
+	}{
+		{
+			name: "context",
+			hit:  matchResult{path: path, line: 3},
+			n:    1,
+			want: "    2  two\n  > 3  three\n    4  four\n\n",
+		},
+		{
+			name: "multi-line declaration",
+			hit:  matchResult{path: path, line: 1, endLine: 2},
+			want: "  > 1  one\n    2  two\n\n",
+		},
+		{
+			name: "shrunk file",
+			hit:  matchResult{path: path, line: 8},
+			n:    3,
+			want: "    5  five\n    (" + path + " has changed: line 8 is gone)\n\n",
+		},
+		{
+			name: "line gone",
+			hit:  matchResult{path: path, line: 20},
+			n:    1,
+			want: "    (" + path + " has changed: line 20 is gone)\n\n",
+		},
+		{
+			name:   "unreadable file",
+			hit:    matchResult{path: missing, line: 1},
+			n:      1,
+			stderr: "note: open " + missing,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			stderr := capture(t, &os.Stderr, func() {
+				got = captureStdout(t, func() {
+					printSource(tt.hit, tt.n)
+				})
+			})
+			if got != tt.want {
+				t.Errorf("printed\n%q\nwant\n%q", got, tt.want)
+			}
+			if !strings.HasPrefix(stderr, tt.stderr) || (tt.stderr == "" && stderr != "") {
+				t.Errorf("printed %q on stderr, want %q", stderr, tt.stderr)
+			}
+		})
+	}
+
+	// The error is only noted for the first hit of the file.
+	if stderr := capture(t, &os.Stderr, func() { printSource(matchResult{path: missing, line: 2}, 1) }); stderr != "" {
+		t.Errorf("noted %q again", stderr)
+	}
+}
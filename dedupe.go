@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// dedupeHits groups the hits by name, in the order of their first hit.
+// The metrics whose names are not known statically are never merged, and
+// come last, as in the text output.
+func dedupeHits(hits byScore) []byScore {
+	var groups, dynamic []byScore
+	index := make(map[string]int)
+	for _, hit := range hits {
+		if hit.dynamic || hit.val == "" {
+			dynamic = append(dynamic, byScore{hit})
+			continue
+		}
+		i, ok := index[hit.val]
+		if !ok {
+			i = len(groups)
+			index[hit.val] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], hit)
+	}
+	return append(groups, dynamic...)
+}
+
+// dedupeConflicts returns the distinct kinds and label sets of the hits
+// of a name, when they disagree. The Desc of a metric does not tell its
+// kind, so it only disagrees with the other kinds when it is alone.
+func dedupeConflicts(hits byScore) (kinds, labels []string) {
+	seenKinds := make(map[string]bool)
+	seenLabels := make(map[string]bool)
+	for _, hit := range hits {
+		if hit.kind != desc && !seenKinds[hit.kind.String()] {
+			seenKinds[hit.kind.String()] = true
+			kinds = append(kinds, hit.kind.String())
+		}
+		set := "{" + strings.ReplaceAll(docsLabels(hit), "`", "") + "}"
+		if !seenLabels[set] {
+			seenLabels[set] = true
+			labels = append(labels, set)
+		}
+	}
+	if len(kinds) < 2 {
+		kinds = nil
+	}
+	if len(labels) < 2 {
+		labels = nil
+	}
+	return kinds, labels
+}
+
+// dedupeFirst returns the hit whose name, kind and help are printed for
+// a name: the first that is not a Desc, if any.
+func dedupeFirst(hits byScore) matchResult {
+	for _, hit := range hits {
+		if hit.kind != desc {
+			return hit
+		}
+	}
+	return hits[0]
+}
+
+// writeDedupe prints each name once with its kind and help, followed by
+// the locations declaring it, indented, and the kinds and label sets
+// when they disagree between the locations.
+func writeDedupe(hits byScore) error {
+	for _, group := range dedupeHits(hits) {
+		first := dedupeFirst(group)
+		name := colorName(first) + formatLabels(first.constLabels, first.labels, first.labelsExpr, labelFlag)
+		if first.dynamic && first.nameExpr != "" {
+			name += " (" + first.nameExpr + ")"
+		}
+		kind := colorize(kindColors[first.kind], first.kind.String())
+		fmt.Printf("%s %s:", name, kind)
+		if help := singleLine(first.help); help != "" {
+			fmt.Print(" " + help)
+		}
+		if !first.listed {
+			fmt.Printf(" score:%d", first.score)
+		}
+		fmt.Println()
+		for _, hit := range group {
+			location := fmt.Sprintf("%s:%d", hit.path, hit.line)
+			if *columnFlag {
+				location += fmt.Sprintf(":%d", max(hit.column, 1))
+			}
+			fmt.Printf("    %s%s %s\n", colorize(dim, location), formatContext(hit.varName, hit.structType, hit.fieldName, hit.funcName), hit.kind)
+		}
+		kinds, labels := dedupeConflicts(group)
+		if kinds != nil {
+			fmt.Printf("    kinds disagree: %s\n", strings.Join(kinds, ", "))
+		}
+		if labels != nil {
+			fmt.Printf("    label sets disagree: %s\n", strings.Join(labels, ", "))
+		}
+	}
+	return nil
+}
+
+// jsonDedupe is a name in the JSON output with --dedupe. Kinds and
+// LabelSets are only set when they disagree between the locations.
+type jsonDedupe struct {
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"`
+	Help      *string   `json:"help"`
+	Kinds     []string  `json:"kinds,omitempty"`
+	LabelSets []string  `json:"labelSets,omitempty"`
+	Locations []jsonHit `json:"locations"`
+}
+
+// writeDedupeJSON prints the hits as a JSON array of names, each with
+// the hits declaring it.
+func writeDedupeJSON(hits byScore) error {
+	groups := dedupeHits(hits)
+	jds := make([]jsonDedupe, 0, len(groups))
+	for _, group := range groups {
+		first := newJSONHit(dedupeFirst(group))
+		jd := jsonDedupe{Name: first.Name, Kind: first.Kind, Help: first.Help}
+		jd.Kinds, jd.LabelSets = dedupeConflicts(group)
+		for _, hit := range group {
+			jd.Locations = append(jd.Locations, newJSONHit(hit))
+		}
+		jds = append(jds, jd)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(jds)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestWriteDedupe(t *testing.T) {
+	hits := byScore{
+		{listed: true, path: "a.go", line: 5, val: "jobs_total", kind: desc, help: "Jobs run.", varName: "jobsDesc"},
+		{listed: true, path: "b.go", line: 3, val: "jobs_total", kind: counter, help: "Jobs run.", labels: []string{"queue"}},
+		{listed: true, path: "c.go", line: 8, val: "jobs_total", kind: gauge, help: "Jobs."},
+		{listed: true, path: "d.go", line: 2, val: "up", kind: gauge, help: "Up."},
+	}
+	out := captureStdout(t, func() {
+		if err := writeDedupe(hits); err != nil {
+			t.Fatal(err)
+		}
+	})
+	want := `jobs_total{queue} Counter: Jobs run.
+    a.go:5 (var jobsDesc) Desc
+    b.go:3 Counter
+    c.go:8 Gauge
+    kinds disagree: Counter, Gauge
+    label sets disagree: {}, {queue}
+up Gauge: Up.
+    d.go:2 Gauge
+`
+	if out != want {
+		t.Errorf("printed\n%s\nwant\n%s", out, want)
+	}
+
+	out = captureStdout(t, func() {
+		if err := writeDedupeJSON(hits); err != nil {
+			t.Fatal(err)
+		}
+	})
+	var got []jsonDedupe
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("%v in %s", err, out)
+	}
+	if len(got) != 2 || got[0].Name != "jobs_total" || got[0].Kind != "Counter" || len(got[0].Locations) != 3 || got[1].Name != "up" {
+		t.Fatalf("got %+v, want jobs_total with 3 locations and up", got)
+	}
+	if want := []string{"Counter", "Gauge"}; !reflect.DeepEqual(got[0].Kinds, want) {
+		t.Errorf("kinds %v, want %v", got[0].Kinds, want)
+	}
+	if got[1].Kinds != nil || got[1].LabelSets != nil {
+		t.Errorf("up has kinds %v and label sets %v, want none", got[1].Kinds, got[1].LabelSets)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// docsNoNamespace is the heading of the metrics without a namespace. It
+// is not a valid namespace, so that no namespace is mixed up with it.
+const docsNoNamespace = "(no namespace)"
+
+// docsNamespace returns the namespace a metric is documented under: its
+// Namespace, or the first part of its name, if known statically.
+func docsNamespace(hit matchResult) string {
+	ns := hit.opts["Namespace"]
+	if i := strings.Index(hit.val, "_"); ns == "" && i > 0 {
+		ns = hit.val[:i]
+	}
+	if ns == "" || placeholder.MatchString(ns) {
+		return docsNoNamespace
+	}
+	return ns
+}
+
+// writeDocs prints a Markdown catalogue of the metrics, with a section
+// per namespace and a subsection per subsystem. Everything is sorted so
+// that generating it again gives the same document.
+func writeDocs(hits byScore) int {
+	namespaces := make(map[string]map[string]byScore)
+	for _, hit := range hits {
+		if hit.kind == recordingRule {
+			continue
+		}
+		ns := docsNamespace(hit)
+		if namespaces[ns] == nil {
+			namespaces[ns] = make(map[string]byScore)
+		}
+		subsystem := hit.opts["Subsystem"]
+		namespaces[ns][subsystem] = append(namespaces[ns][subsystem], hit)
+	}
+	names := sortedKeys(namespaces)
+
+	fmt.Println("# Metrics")
+	fmt.Println()
+	fmt.Println("Generated by promgrep --docs. Do not edit.")
+	fmt.Println()
+	for _, ns := range names {
+		fmt.Printf("- [`%s`](#%s)\n", ns, docsAnchor(ns))
+	}
+	for _, ns := range names {
+		fmt.Printf("\n## `%s`\n", ns)
+		for _, subsystem := range sortedKeys(namespaces[ns]) {
+			if subsystem != "" {
+				fmt.Printf("\n### `%s`\n", subsystem)
+			}
+			fmt.Println()
+			writeDocsTable(namespaces[ns][subsystem])
+		}
+	}
+
+	if len(hits) == 0 {
+		return 1
+	}
+	return 0
+}
+
+// docsAnchor returns the anchor of the heading of a namespace, as
+// GitHub generates it: lower-cased, without punctuation, with dashes
+// for spaces.
+func docsAnchor(ns string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == ' ':
+			return '-'
+		case r == '-', r == '_', unicode.IsLetter(r), unicode.IsDigit(r):
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, ns)
+}
+
+// sortedKeys returns the keys of a map in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writeDocsTable prints the table of the metrics of a subsystem.
+func writeDocsTable(hits byScore) {
+	sort.SliceStable(hits, func(i, j int) bool {
+		a, b := hits[i], hits[j]
+		if a.val != b.val {
+			return a.val < b.val
+		}
+		if a.path != b.path {
+			return a.path < b.path
+		}
+		return a.line < b.line
+	})
+
+	fmt.Println("| Name | Type | Labels | Buckets/Objectives | Help | Source |")
+	fmt.Println("| --- | --- | --- | --- | --- | --- |")
+	for _, hit := range hits {
+		fmt.Printf("| `%s` | %s | %s | %s | %s | [%s:%d](%s#L%d) |\n", hit.val, strings.ToLower(hit.kind.String()),
+			markdownCell(docsLabels(hit), 0), markdownCell(docsDistribution(hit), 0),
+			markdownCell(singleLine(hit.help), 0), hit.path, hit.line, hit.path, hit.line)
+	}
+}
+
+// docsLabels renders the variable and const labels of a metric.
+func docsLabels(hit matchResult) string {
+	var labels []string
+	for _, l := range hit.labels {
+		labels = append(labels, "`"+l+"`")
+	}
+	if hit.labelsExpr != "" {
+		labels = append(labels, "`"+hit.labelsExpr+"`")
+	}
+	keys := make([]string, 0, len(hit.constLabels))
+	for k := range hit.constLabels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		labels = append(labels, fmt.Sprintf("`%s=%q`", k, hit.constLabels[k]))
+	}
+	return strings.Join(labels, ", ")
+}
+
+// docsDistribution renders the buckets of a histogram or the objectives
+// of a summary.
+func docsDistribution(hit matchResult) string {
+	switch hit.kind {
+	case histogram:
+		buckets, def := histogramBuckets(hit)
+		switch {
+		case def:
+			return "default"
+		case buckets != nil:
+			return fmt.Sprint(buckets)
+		case hit.bucketsExpr != "":
+			return "`" + hit.bucketsExpr + "`"
+		}
+	case summary:
+		switch {
+		case hit.objectives != nil:
+			return fmt.Sprint(hit.objectives)
+		case hit.objectivesExpr != "":
+			return "`" + hit.objectivesExpr + "`"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDocs(t *testing.T) {
+	hits := scanOne(t, `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	a = prometheus.NewCounter(prometheus.CounterOpts{Namespace: "src", Subsystem: "http", Name: "requests_total", Help: "Requests."})
+	b = prometheus.NewHistogram(prometheus.HistogramOpts{Name: "other_latency_seconds"})
+	c = prometheus.NewGauge(prometheus.GaugeOpts{Name: "up"})
+)
+`)
+	out := captureStdout(t, func() {
+		if code := writeDocs(hits); code != 0 {
+			t.Errorf("writeDocs returned %d, want 0", code)
+		}
+	})
+	for _, want := range []string{
+		"- [`(no namespace)`](#no-namespace)\n- [`other`](#other)\n- [`src`](#src)\n",
+		"\n## `(no namespace)`\n\n| Name |",
+		"| `up` | gauge |  |  |  | [m.go:8](m.go#L8) |",
+		"\n## `other`\n\n| Name |",
+		"| `other_latency_seconds` | histogram |  | default |  | [m.go:7](m.go#L7) |",
+		"\n## `src`\n\n### `http`\n\n| Name |",
+		"| `src_http_requests_total` | counter |  |  | Requests. | [m.go:6](m.go#L6) |",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("the catalogue\n%s\ndoes not contain\n%s", out, want)
+		}
+	}
+}
+
+func TestDocsAnchor(t *testing.T) {
+	for ns, want := range map[string]string{
+		"src":            "src",
+		"src_frontend":   "src_frontend",
+		"(no namespace)": "no-namespace",
+	} {
+		if got := docsAnchor(ns); got != want {
+			t.Errorf("docsAnchor(%q) = %q, want %q", ns, got, want)
+		}
+	}
+}
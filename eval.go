@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// evalString evaluates string expressions built from literals, constants
+// and variables declared in the file, + concatenation and fmt.Sprintf.
+// Identifiers that cannot be resolved are rendered as <ident> and other
+// unresolved parts as "?"; ok reports whether the whole expression was
+// resolved.
+func evalString(expr ast.Expr, fi *fileInfo) (val string, ok bool) {
+	if fi.info != nil {
+		if val, ok := typedString(expr, fi.info); ok {
+			return val, true
+		}
+	}
+
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		if e.Kind == token.STRING {
+			return unquote(e.Value), true
+		}
+	case *ast.ParenExpr:
+		return evalString(e.X, fi)
+	case *ast.BinaryExpr:
+		if e.Op != token.ADD {
+			break
+		}
+		x, xok := evalString(e.X, fi)
+		y, yok := evalString(e.Y, fi)
+		return x + y, xok && yok
+	case *ast.CallExpr:
+		if types.ExprString(e.Fun) == "fmt.Sprintf" && len(e.Args) > 0 {
+			return evalSprintf(e.Args[0], e.Args[1:], fi)
+		}
+	case *ast.Ident:
+		// Constants and variables initialized in their declaration
+		// resolve to their value; the type checker resolves shadowing
+		// for us.
+		switch obj := fi.object(e); obj.(type) {
+		case *types.Const, *types.Var:
+			if val, ok := fi.values[obj]; ok {
+				if v, ok := evalString(val, fi); ok {
+					return v, true
+				}
+			}
+		}
+		return "<" + e.Name + ">", false
+	}
+	return "?", false
+}
+
+// placeholder matches the parts of a name evalString could not resolve.
+var placeholder = regexp.MustCompile(`\?|<[^<>]*>`)
+
+// evalSprintf formats the arguments that can be resolved and replaces
+// the verbs of the others with their placeholders.
+func evalSprintf(format ast.Expr, args []ast.Expr, fi *fileInfo) (string, bool) {
+	f, ok := evalString(format, fi)
+	if !ok {
+		return "?", false
+	}
+
+	var b strings.Builder
+	resolved := true
+	for len(f) > 0 {
+		i := strings.IndexByte(f, '%')
+		if i < 0 || i == len(f)-1 {
+			b.WriteString(f)
+			break
+		}
+		b.WriteString(f[:i])
+		f = f[i+1:]
+		if f[0] == '%' {
+			b.WriteByte('%')
+			f = f[1:]
+			continue
+		}
+		// The verb is the first letter after the flags, width and precision.
+		end := strings.IndexFunc(f, unicode.IsLetter)
+		if end < 0 {
+			b.WriteString("%" + f)
+			break
+		}
+		verb := "%" + f[:end+1]
+		f = f[end+1:]
+
+		if len(args) == 0 {
+			b.WriteString("?")
+			resolved = false
+			continue
+		}
+		val, ok := evalString(args[0], fi)
+		args = args[1:]
+		if !ok {
+			b.WriteString(val)
+			resolved = false
+			continue
+		}
+		b.WriteString(fmt.Sprintf(verb, val))
+	}
+	return b.String(), resolved
+}
+
+// matchFragments matches a metric name with placeholders against a
+// query: the resolved fragments of the name must appear in the query in
+// order. It returns the number of query bytes covered by the fragments.
+func matchFragments(query, name string) (int, bool) {
+	covered := 0
+	for _, fragment := range placeholder.Split(name, -1) {
+		i := strings.Index(query, fragment)
+		if i < 0 {
+			return 0, false
+		}
+		query = query[i+len(fragment):]
+		covered += len(fragment)
+	}
+	return covered, true
+}
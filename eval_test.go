@@ -0,0 +1,110 @@
+package main
+
+import "testing"
+
+func TestConcatenatedNames(t *testing.T) {
+	src := `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+const prefix = "gitserver"
+
+var (
+	a = prometheus.NewHistogram(prometheus.HistogramOpts{Name: prefix + "_" + "fetch_duration_seconds"})
+	b = prometheus.NewCounter(prometheus.CounterOpts{Name: metricPrefix + "_requests_total"})
+	c = prometheus.NewCounter(prometheus.CounterOpts{Name: ("src" + "_jobs_total")})
+)
+`
+	want := []string{"gitserver_fetch_duration_seconds", "<metricPrefix>_requests_total", "src_jobs_total"}
+	hits := scanOne(t, src)
+	if len(hits) != len(want) {
+		t.Fatalf("got %v, want %v", names(hits), want)
+	}
+	for i, hit := range hits {
+		if hit.val != want[i] {
+			t.Errorf("got %s, want %s", hit.val, want[i])
+		}
+	}
+
+	hits = scanSource(t, map[string]string{"m.go": src}, &matchName{name: "frontend_requests_total"})
+	if len(hits) != 1 || hits[0].val != "<metricPrefix>_requests_total" || hits[0].score != 65 {
+		t.Errorf("frontend_requests_total found %+v, want <metricPrefix>_requests_total with score 65", hits)
+	}
+}
+
+func TestMatchFragments(t *testing.T) {
+	for _, tt := range []struct {
+		query, name string
+		covered     int
+		ok          bool
+	}{
+		{"src_requests_total", "<metricPrefix>_requests_total", 15, true},
+		{"src_http_requests_total", "src_?_requests_total", 19, true},
+		{"requests_total_src", "src_?_requests_total", 0, false},
+		{"src_errors_total", "<metricPrefix>_requests_total", 0, false},
+	} {
+		covered, ok := matchFragments(tt.query, tt.name)
+		if covered != tt.covered || ok != tt.ok {
+			t.Errorf("matchFragments(%q, %q) = %d, %v, want %d, %v", tt.query, tt.name, covered, ok, tt.covered, tt.ok)
+		}
+	}
+}
+
+func TestSprintfNames(t *testing.T) {
+	hits := scanOne(t, `package m
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	ns  = "src"
+	sub = "gitserver"
+)
+
+var (
+	a = prometheus.NewHistogram(prometheus.HistogramOpts{Name: fmt.Sprintf("%s_%s_duration_seconds", ns, sub)})
+	b = prometheus.NewCounter(prometheus.CounterOpts{Name: fmt.Sprintf("%s_%s_errors_total", ns, component)})
+	c = prometheus.NewGauge(prometheus.GaugeOpts{Name: fmt.Sprintf("%-4s_100%%_up", "x")})
+)
+`)
+	want := []string{"src_gitserver_duration_seconds", "src_<component>_errors_total", "x   _100%_up"}
+	if len(hits) != len(want) {
+		t.Fatalf("got %v, want %v", names(hits), want)
+	}
+	for i, hit := range hits {
+		if hit.val != want[i] {
+			t.Errorf("got %q, want %q", hit.val, want[i])
+		}
+	}
+}
+
+func TestConstantNames(t *testing.T) {
+	hits := scanOne(t, `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+const namespace = "src"
+
+var subsystem = "http"
+
+var a = prometheus.NewCounter(prometheus.CounterOpts{Namespace: namespace, Subsystem: subsystem, Name: "requests_total"})
+
+func newMetrics() {
+	const namespace = "local"
+	prometheus.NewCounter(prometheus.CounterOpts{Namespace: namespace, Name: "jobs_total"})
+	prometheus.NewCounter(prometheus.CounterOpts{Namespace: namespace, Subsystem: component, Name: "errors_total"})
+}
+`)
+	want := []string{"src_http_requests_total", "local_jobs_total", "local_<component>_errors_total"}
+	if len(hits) != len(want) {
+		t.Fatalf("got %v, want %v", names(hits), want)
+	}
+	for i, hit := range hits {
+		if hit.val != want[i] {
+			t.Errorf("got %q, want %q", hit.val, want[i])
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"go/ast"
+	"go/types"
+)
+
+// structField is a field of a struct a metric is stored in.
+type structField struct {
+	// typ is the name of the struct type, or empty if it is not known.
+	typ  string
+	name string
+}
+
+// recordFields records the constructor calls in the keyed elements of a
+// struct literal, such as metrics{fetches: prometheus.NewCounter(...)}.
+func recordFields(cl *ast.CompositeLit, fi *fileInfo) {
+	typ := ""
+	if cl.Type != nil {
+		typ = types.ExprString(cl.Type)
+	}
+	for _, el := range cl.Elts {
+		kv, ok := el.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		key, ok := kv.Key.(*ast.Ident)
+		if !ok {
+			continue
+		}
+		if c, ok := kv.Value.(*ast.CallExpr); ok {
+			fi.fields[c] = structField{typ: typ, name: key.Name}
+		}
+	}
+}
+
+// structTypeOf returns the name of the struct type of x, the operand of
+// a field selector such as m in m.fetches. Without type information it
+// follows the declaration of x: a typed parameter, receiver or variable,
+// or a variable initialized with a struct literal.
+func structTypeOf(x ast.Expr, fi *fileInfo) string {
+	if fi.info != nil {
+		if t := fi.info.TypeOf(x); t != nil {
+			if p, ok := t.(*types.Pointer); ok {
+				t = p.Elem()
+			}
+			if named, ok := t.(*types.Named); ok {
+				return named.Obj().Name()
+			}
+		}
+	}
+
+	id, ok := x.(*ast.Ident)
+	if !ok {
+		return ""
+	}
+	obj := fi.object(id)
+	var typ ast.Expr
+	switch decl := fi.declarations[obj].(type) {
+	case *ast.Field:
+		typ = decl.Type
+	case *ast.ValueSpec:
+		typ = decl.Type
+		if typ == nil {
+			typ = literalType(fi.values[obj])
+		}
+	case *ast.AssignStmt:
+		typ = literalType(fi.values[obj])
+	}
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	if typ == nil {
+		return ""
+	}
+	return types.ExprString(typ)
+}
+
+// literalType returns the type of a struct literal or of its address.
+func literalType(expr ast.Expr) ast.Expr {
+	if u, ok := expr.(*ast.UnaryExpr); ok {
+		expr = u.X
+	}
+	if cl, ok := expr.(*ast.CompositeLit); ok {
+		return cl.Type
+	}
+	return nil
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// filter is a criterion a hit has to satisfy to be listed. Filters do
+// not change the score, which comes from the name query.
+type filter func(hit matchResult) bool
+
+// filters are satisfied by the hits satisfying all of them.
+type filters []filter
+
+// apply keeps the hits satisfying all the filters.
+func (fs filters) apply(hits byScore) byScore {
+	var kept byScore
+	for _, hit := range hits {
+		if fs.match(hit) {
+			kept = append(kept, hit)
+		}
+	}
+	return kept
+}
+
+func (fs filters) match(hit matchResult) bool {
+	for _, f := range fs {
+		if !f(hit) {
+			return false
+		}
+	}
+	return true
+}
+
+// flagFilters returns the filters selected by the flags.
+func flagFilters() filters {
+	var fs filters
+	minScore := *minScoreFlag
+	if *strictFlag && !isFlagSet("min-score") {
+		minScore = strictMinScore
+	}
+	if minScore > 0 {
+		fs = append(fs, minScoreFilter(minScore))
+	}
+	if *namespaceFlag != "" {
+		fs = append(fs, namespaceFilter(*namespaceFlag, *namespacePrefixFlag))
+	}
+	if isFlagSet("subsystem") {
+		fs = append(fs, subsystemFilter(*subsystemFlag))
+	}
+	if len(kindFlag) > 0 {
+		fs = append(fs, kindFilter(kindFlag))
+	}
+	if len(labelFlag) > 0 {
+		fs = append(fs, labelsFilter(labelFlag))
+	}
+	for _, spec := range constLabelFlag {
+		fs = append(fs, constLabelFilter(spec))
+	}
+	if *helpContainsFlag != "" {
+		fs = append(fs, helpFilter(*helpContainsFlag))
+	}
+	if *registryFlag != "" {
+		fs = append(fs, registryFilter(*registryFlag))
+	}
+	if *varFlag != "" {
+		fs = append(fs, varFilter(*varFlag))
+	}
+	for _, spec := range bucketFlag {
+		f, err := bucketFilter(spec)
+		if err != nil {
+			fatal(err)
+		}
+		fs = append(fs, f)
+	}
+	if len(pathIncludeFlag) > 0 {
+		fs = append(fs, pathFilter(pathIncludeFlag))
+	}
+
+	// Exclusions only drop hits, so they leave the scores alone too.
+	if *notNamespaceFlag != "" {
+		fs = append(fs, not(namespaceFilter(*notNamespaceFlag, false)))
+	}
+	if len(notKindFlag) > 0 {
+		fs = append(fs, not(kindFilter(notKindFlag)))
+	}
+	for _, name := range notLabelFlag {
+		fs = append(fs, not(labelsFilter([]string{name})))
+	}
+	if *excludeFlag != "" {
+		re, err := regexp.Compile(*excludeFlag)
+		if err != nil {
+			fatalf("invalid regular expression %q: %v", *excludeFlag, err)
+		}
+		fs = append(fs, not(nameFilter(re)))
+	}
+	if len(pathExcludeFlag) > 0 {
+		fs = append(fs, not(pathFilter(pathExcludeFlag)))
+	}
+	return fs
+}
+
+// not negates a filter.
+func not(f filter) filter {
+	return func(hit matchResult) bool {
+		return !f(hit)
+	}
+}
+
+// nameFilter keeps the hits whose qualified name matches re.
+func nameFilter(re *regexp.Regexp) filter {
+	return func(hit matchResult) bool {
+		return re.MatchString(hit.val)
+	}
+}
+
+// registryFilter keeps the hits registered with a registry, named by
+// its expression or the last identifier of it, such as debugRegistry
+// for s.debugRegistry. The hits whose registration is not found are in
+// the "unknown" registry.
+func registryFilter(registry string) filter {
+	return func(hit matchResult) bool {
+		if len(hit.registrations) == 0 {
+			return registry == "unknown"
+		}
+		for _, reg := range hit.registrations {
+			if reg.registry == registry || strings.HasSuffix(reg.registry, "."+registry) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// varFilter keeps the hits assigned to a variable or a struct field
+// whose name contains ident, regardless of case.
+func varFilter(ident string) filter {
+	ident = strings.ToLower(ident)
+	return func(hit matchResult) bool {
+		return (hit.varName != "" && strings.Contains(strings.ToLower(hit.varName), ident)) ||
+			(hit.fieldName != "" && strings.Contains(strings.ToLower(hit.fieldName), ident))
+	}
+}
+
+// bucketFilter keeps the histograms with a bucket boundary equal to the
+// value of spec, or satisfying its comparison such as >=30. Histograms
+// whose Buckets cannot be evaluated are dropped.
+func bucketFilter(spec string) (filter, error) {
+	op := strings.TrimRight(spec, "0123456789.eE+-")
+	value, err := strconv.ParseFloat(strings.TrimSpace(spec[len(op):]), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bucket %q: %v", spec, err)
+	}
+	var satisfies func(float64) bool
+	switch strings.TrimSpace(op) {
+	case "", "=", "==":
+		satisfies = func(b float64) bool { return math.Abs(b-value) <= 1e-9*math.Max(1, math.Abs(value)) }
+	case ">":
+		satisfies = func(b float64) bool { return b > value }
+	case ">=":
+		satisfies = func(b float64) bool { return b >= value }
+	case "<":
+		satisfies = func(b float64) bool { return b < value }
+	case "<=":
+		satisfies = func(b float64) bool { return b <= value }
+	default:
+		return nil, fmt.Errorf("invalid bucket %q: unknown comparison %q", spec, op)
+	}
+
+	return func(hit matchResult) bool {
+		if hit.kind != histogram {
+			return false
+		}
+		buckets, _ := histogramBuckets(hit)
+		for _, b := range buckets {
+			if satisfies(b) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// pathFilter keeps the hits declared in a file matching one of the
+// globs, or under a directory matching one of them.
+func pathFilter(globs []string) filter {
+	patterns := make([]string, len(globs))
+	for i, glob := range globs {
+		patterns[i] = path.Clean(filepath.ToSlash(glob))
+		if _, err := path.Match(patterns[i], ""); err != nil {
+			fatalf("invalid path pattern %q: %v", glob, err)
+		}
+	}
+	return func(hit matchResult) bool {
+		// The file and each of its parent directories.
+		for p := path.Clean(filepath.ToSlash(hit.path)); p != "." && p != "/"; p = path.Dir(p) {
+			for _, pattern := range patterns {
+				if ok, _ := path.Match(pattern, p); ok {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// strictMinScore is the minimum score of matches with --strict.
+const strictMinScore = 30
+
+// minScoreFilter drops the matches scoring below threshold. Listings
+// without a query are not scored and are kept.
+func minScoreFilter(threshold int) filter {
+	return func(hit matchResult) bool {
+		return hit.listed || hit.score >= threshold
+	}
+}
+
+// kindFilter keeps the hits of the given kinds.
+func kindFilter(kinds []metricKind) filter {
+	return func(hit matchResult) bool {
+		for _, kind := range kinds {
+			if hit.kind == kind {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// namespaceFilter keeps the hits in a namespace, either set in their
+// Namespace field or as the first part of their name.
+func namespaceFilter(namespace string, prefix bool) filter {
+	return func(hit matchResult) bool {
+		ns := hit.opts["Namespace"]
+		if prefix {
+			return strings.HasPrefix(ns, namespace) || strings.HasPrefix(hit.val, namespace)
+		}
+		return ns == namespace || strings.HasPrefix(hit.val, namespace+"_")
+	}
+}
+
+// subsystemFilter keeps the hits whose Subsystem is subsystem.
+func subsystemFilter(subsystem string) filter {
+	return func(hit matchResult) bool {
+		return hit.opts["Subsystem"] == subsystem
+	}
+}
+
+// labelsFilter keeps the hits having all the given labels, as variable
+// labels or const labels.
+func labelsFilter(names []string) filter {
+	return func(hit matchResult) bool {
+		for _, name := range names {
+			found := false
+			if _, ok := hit.constLabels[name]; ok {
+				found = true
+			}
+			for _, l := range hit.labels {
+				found = found || l == name
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// constLabelFilter keeps the hits with a const label given as
+// key=value, or as a key alone to accept any value.
+func constLabelFilter(spec string) filter {
+	key, value, hasValue := strings.Cut(spec, "=")
+	return func(hit matchResult) bool {
+		v, ok := hit.constLabels[key]
+		return ok && (!hasValue || v == value)
+	}
+}
+
+// helpFilter keeps the hits whose help contains text, ignoring case.
+func helpFilter(text string) filter {
+	text = strings.ToLower(text)
+	return func(hit matchResult) bool {
+		return strings.Contains(strings.ToLower(singleLine(hit.help)), text)
+	}
+}
+
+// scoreHelp scores the hits of a listing without a name query by the
+// share of their help the text covers.
+func scoreHelp(hits byScore, text string) {
+	for i := range hits {
+		if help := singleLine(hits[i].help); hits[i].listed && help != "" {
+			hits[i].score = len(text) * 100 / len(help)
+			hits[i].listed = false
+		}
+	}
+}
+
+// stringsFlag is a flag that can be repeated.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
@@ -0,0 +1,473 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"sort"
+	"testing"
+)
+
+const filtersSource = `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	a = prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: "src", Name: "errors_total", Help: "Failed requests."}, []string{"code"})
+	b = prometheus.NewGauge(prometheus.GaugeOpts{Namespace: "src", Name: "errors_inflight"})
+	c = prometheus.NewCounter(prometheus.CounterOpts{Namespace: "other", Name: "errors_total"})
+	d = prometheus.NewCounter(prometheus.CounterOpts{Namespace: "src", Name: "search_errors_total", Help: "Failed searches."})
+	e = prometheus.NewCounter(prometheus.CounterOpts{Namespace: "src", Name: "requests_total"})
+)
+`
+
+func TestFilters(t *testing.T) {
+	scored := scanSource(t, map[string]string{"m.go": filtersSource}, &matchName{name: "errors"})
+	scores := make(map[string]int)
+	for _, hit := range scored {
+		scores[hit.val] = hit.score
+	}
+
+	for _, tt := range []struct {
+		name string
+		fs   filters
+		want []string
+	}{
+		{"none", nil, []string{"other_errors_total", "src_errors_inflight", "src_errors_total", "src_search_errors_total"}},
+		{"kind", filters{kindFilter([]metricKind{counter})}, []string{"other_errors_total", "src_errors_total", "src_search_errors_total"}},
+		{
+			"kind and namespace",
+			filters{kindFilter([]metricKind{counter}), namespaceFilter("src", false)},
+			[]string{"src_errors_total", "src_search_errors_total"},
+		},
+		{
+			"kind, namespace and label",
+			filters{kindFilter([]metricKind{counter}), namespaceFilter("src", false), labelsFilter([]string{"code"})},
+			[]string{"src_errors_total"},
+		},
+		{
+			"kind, namespace and help",
+			filters{kindFilter([]metricKind{counter}), namespaceFilter("src", false), helpFilter("SEARCHES")},
+			[]string{"src_search_errors_total"},
+		},
+		{
+			"exclusion",
+			filters{namespaceFilter("src", false), not(kindFilter([]metricKind{gauge}))},
+			[]string{"src_errors_total", "src_search_errors_total"},
+		},
+		{"disjoint", filters{kindFilter([]metricKind{gauge}), labelsFilter([]string{"code"})}, nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			kept := tt.fs.apply(append(byScore(nil), scored...))
+			got := names(kept)
+			sort.Strings(got)
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for _, hit := range kept {
+				if hit.score != scores[hit.val] {
+					t.Errorf("%s has score %d, want %d from the name query", hit.val, hit.score, scores[hit.val])
+				}
+			}
+		})
+	}
+}
+
+func TestFlagFilters(t *testing.T) {
+	setFlag(t, &kindFlag, kindsFlag{counter})
+	setFlag(t, namespaceFlag, "src")
+	hits := scanSource(t, map[string]string{"m.go": filtersSource}, &matchName{name: "errors"})
+	got := names(flagFilters().apply(hits))
+	sort.Strings(got)
+	want := []string{"src_errors_total", "src_search_errors_total"}
+	if !slices.Equal(got, want) {
+		t.Errorf("--kind=counter --namespace=src errors found %v, want %v", got, want)
+	}
+}
+
+func TestExclusionFlags(t *testing.T) {
+	setFlag(t, notNamespaceFlag, "other")
+	setFlag(t, &notKindFlag, kindsFlag{gauge})
+	setFlag(t, &notLabelFlag, stringsFlag{"code"})
+	setFlag(t, excludeFlag, "^src_search_")
+	hits := scanSource(t, map[string]string{"m.go": filtersSource}, &matchName{name: "errors"})
+	scores := make(map[string]int)
+	for _, hit := range hits {
+		scores[hit.val] = hit.score
+	}
+	kept := flagFilters().apply(hits)
+	if got := names(kept); len(got) != 0 {
+		t.Errorf("the exclusions kept %v, want nothing", got)
+	}
+
+	setFlag(t, &notLabelFlag, nil)
+	kept = flagFilters().apply(hits)
+	if got := names(kept); !slices.Equal(got, []string{"src_errors_total"}) {
+		t.Fatalf("the exclusions kept %v, want [src_errors_total]", got)
+	}
+	if kept[0].score != scores["src_errors_total"] {
+		t.Errorf("src_errors_total has score %d, want %d from the name query", kept[0].score, scores["src_errors_total"])
+	}
+}
+
+func TestMinScore(t *testing.T) {
+	hits := scanSource(t, map[string]string{"m.go": filtersSource}, &matchName{name: "errors"})
+	scores := make(map[string]int)
+	for _, hit := range hits {
+		scores[hit.val] = hit.score
+	}
+	for _, tt := range []struct {
+		minScore int
+		strict   bool
+	}{
+		{0, false},
+		{33, false},
+		{0, true},
+		{100, true},
+	} {
+		setFlag(t, minScoreFlag, tt.minScore)
+		setFlag(t, strictFlag, tt.strict)
+		threshold := tt.minScore
+		if tt.strict {
+			threshold = strictMinScore
+		}
+		var want []string
+		for name, score := range scores {
+			if score >= threshold {
+				want = append(want, name)
+			}
+		}
+		sort.Strings(want)
+		got := names(flagFilters().apply(hits))
+		sort.Strings(got)
+		if !slices.Equal(got, want) {
+			t.Errorf("--min-score=%d --strict=%t kept %v, want %v from %v", tt.minScore, tt.strict, got, want, scores)
+		}
+	}
+
+	listed := scanSource(t, map[string]string{"m.go": filtersSource}, &matchAny{})
+	if kept := (filters{minScoreFilter(50)}).apply(listed); len(kept) != len(listed) {
+		t.Errorf("--min-score=50 kept %v of the listing, want all of %v", names(kept), names(listed))
+	}
+}
+
+func TestConstLabelFilter(t *testing.T) {
+	hits := scanSource(t, map[string]string{"m.go": `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	a = prometheus.NewCounter(prometheus.CounterOpts{Name: "http_requests_total", ConstLabels: prometheus.Labels{"component": "frontend"}})
+	b = prometheus.NewCounter(prometheus.CounterOpts{Name: "http_requests_total", ConstLabels: prometheus.Labels{"component": "gitserver", "zone": "a"}})
+	c = prometheus.NewCounter(prometheus.CounterOpts{Name: "http_requests_total"})
+)
+`}, &matchName{name: "http_requests_total"})
+	for _, tt := range []struct {
+		specs []string
+		want  []string
+	}{
+		{[]string{"component=frontend"}, []string{"frontend"}},
+		{[]string{"component"}, []string{"frontend", "gitserver"}},
+		{[]string{"component", "zone=a"}, []string{"gitserver"}},
+		{[]string{"component=search"}, nil},
+		{[]string{"component="}, nil},
+	} {
+		var fs filters
+		for _, spec := range tt.specs {
+			fs = append(fs, constLabelFilter(spec))
+		}
+		var got []string
+		for _, hit := range fs.apply(hits) {
+			got = append(got, hit.constLabels["component"])
+		}
+		sort.Strings(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("--const-label %v found the components %v, want %v", tt.specs, got, tt.want)
+		}
+	}
+}
+
+func TestRegistryFilter(t *testing.T) {
+	hits := scanOne(t, `package m
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+type server struct {
+	debugRegistry *prometheus.Registry
+}
+
+var (
+	requests = prometheus.NewCounter(prometheus.CounterOpts{Name: "requests_total"})
+	latency  = prometheus.NewHistogram(prometheus.HistogramOpts{Name: "latency_seconds"})
+	unused   = prometheus.NewGauge(prometheus.GaugeOpts{Name: "unused"})
+	auto     = promauto.NewCounter(prometheus.CounterOpts{Name: "auto_total"})
+	pushed   = promauto.With(pushRegistry).NewCounter(prometheus.CounterOpts{Name: "pushed_total"})
+)
+
+func (s *server) init() {
+	prometheus.MustRegister(requests)
+	s.debugRegistry.MustRegister(latency)
+}
+`)
+	for registry, want := range map[string][]string{
+		"default":         {"auto_total", "requests_total"},
+		"debugRegistry":   {"latency_seconds"},
+		"s.debugRegistry": {"latency_seconds"},
+		"pushRegistry":    {"pushed_total"},
+		"unknown":         {"unused"},
+		"Registry":        nil,
+	} {
+		got := names(filters{registryFilter(registry)}.apply(hits))
+		sort.Strings(got)
+		if !slices.Equal(got, want) {
+			t.Errorf("--registry %s found %v, want %v", registry, got, want)
+		}
+	}
+}
+
+func TestVarFilter(t *testing.T) {
+	hits := scanOne(t, `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var fetchDurationSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{Name: "src_fetch_duration_seconds"})
+
+type metrics struct {
+	fetches prometheus.Counter
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		fetches: prometheus.NewCounter(prometheus.CounterOpts{Name: "src_fetches_total"}),
+	}
+}
+
+func register() {
+	prometheus.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "src_fetch_queue"}))
+}
+`)
+	for ident, want := range map[string][]string{
+		"fetchDurationSeconds": {"src_fetch_duration_seconds"},
+		"duration":             {"src_fetch_duration_seconds"},
+		"Fetches":              {"src_fetches_total"},
+		"fetch":                {"src_fetch_duration_seconds", "src_fetches_total"},
+		"queue":                nil,
+	} {
+		got := names(filters{varFilter(ident)}.apply(hits))
+		sort.Strings(got)
+		if !slices.Equal(got, want) {
+			t.Errorf("--var %s found %v, want %v", ident, got, want)
+		}
+	}
+}
+
+func TestBucketFilter(t *testing.T) {
+	hits := scanOne(t, `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	a = prometheus.NewHistogram(prometheus.HistogramOpts{Name: "a_seconds"})
+	b = prometheus.NewHistogram(prometheus.HistogramOpts{Name: "b_seconds", Buckets: []float64{0.1, 1, 30, 60}})
+	c = prometheus.NewHistogram(prometheus.HistogramOpts{Name: "c_seconds", Buckets: buckets()})
+	d = prometheus.NewGauge(prometheus.GaugeOpts{Name: "d_seconds"})
+)
+`)
+	for _, tt := range []struct {
+		spec string
+		want []string
+	}{
+		{"10", []string{"a_seconds"}},
+		{"0.1", []string{"a_seconds", "b_seconds"}},
+		{"=.1", []string{"a_seconds", "b_seconds"}},
+		{">=30", []string{"b_seconds"}},
+		{"> 10", []string{"b_seconds"}},
+		{"<0.01", []string{"a_seconds"}},
+		{"<= 0.01", []string{"a_seconds"}},
+		{"2", nil},
+	} {
+		f, err := bucketFilter(tt.spec)
+		if err != nil {
+			t.Errorf("--bucket %s: %v", tt.spec, err)
+			continue
+		}
+		got := names(filters{f}.apply(hits))
+		sort.Strings(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("--bucket %s found %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+	for _, spec := range []string{"", "ten", "~10"} {
+		if _, err := bucketFilter(spec); err == nil {
+			t.Errorf("--bucket %q is accepted", spec)
+		}
+	}
+}
+
+func TestPathFilters(t *testing.T) {
+	hits := byScore{
+		{val: "a_total", path: "cmd/gitserver/server.go"},
+		{val: "b_total", path: "cmd/gitserver/example/main.go"},
+		{val: "c_total", path: "cmd/frontend/app.go"},
+		{val: "d_total", path: "internal/metrics.go"},
+	}
+	for _, tt := range []struct {
+		include, exclude []string
+		want             []string
+	}{
+		{[]string{"cmd/gitserver"}, nil, []string{"a_total", "b_total"}},
+		{[]string{"cmd/*"}, nil, []string{"a_total", "b_total", "c_total"}},
+		{[]string{"internal/*.go"}, nil, []string{"d_total"}},
+		{[]string{"cmd/*", "internal"}, nil, []string{"a_total", "b_total", "c_total", "d_total"}},
+		{nil, []string{"*/*/example"}, []string{"a_total", "c_total", "d_total"}},
+		{[]string{"./cmd/gitserver/"}, []string{"cmd/gitserver/example"}, []string{"a_total"}},
+	} {
+		var fs filters
+		if tt.include != nil {
+			fs = append(fs, pathFilter(tt.include))
+		}
+		if tt.exclude != nil {
+			fs = append(fs, not(pathFilter(tt.exclude)))
+		}
+		if got := names(fs.apply(hits)); !slices.Equal(got, tt.want) {
+			t.Errorf("--path-include %v --path-exclude %v found %v, want %v", tt.include, tt.exclude, got, tt.want)
+		}
+	}
+}
+
+func TestHelpContains(t *testing.T) {
+	src := `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	a = prometheus.NewHistogram(prometheus.HistogramOpts{Name: "fetch_seconds", Help: "Fetch latency."})
+	b = prometheus.NewHistogram(prometheus.HistogramOpts{Name: "clone_seconds", Help: "Clone latency of the\n\trepositories that are fetched by the worker."})
+	c = prometheus.NewCounter(prometheus.CounterOpts{Name: "fetches_total", Help: "Fetches started."})
+)
+`
+	listed := filters{helpFilter("LATENCY")}.apply(scanSource(t, map[string]string{"m.go": src}, &matchAny{}))
+	scoreHelp(listed, "LATENCY")
+	scores := make(map[string]int)
+	for _, hit := range listed {
+		scores[hit.val] = hit.score
+	}
+	want := map[string]int{"fetch_seconds": 50, "clone_seconds": 10}
+	if !maps.Equal(scores, want) {
+		t.Errorf("--help-contains=LATENCY found %v, want %v", scores, want)
+	}
+
+	byName := scanSource(t, map[string]string{"m.go": src}, &matchName{name: "fetch"})
+	sort.Sort(byName)
+	named := filters{helpFilter("latency")}.apply(byName)
+	scoreHelp(named, "latency")
+	if len(named) != 1 || named[0].val != "fetch_seconds" || named[0].score != byName[0].score {
+		t.Errorf("fetch --help-contains=latency found %v, want fetch_seconds with the score of the name", names(named))
+	}
+
+	setFlag(t, &colorOutput, true)
+	if got, want := emphasizeFragment("Fetch latency.", "LATENCY"), "Fetch \x1b[1mlatency\x1b[0m."; got != want {
+		t.Errorf("emphasizeFragment() = %q, want %q", got, want)
+	}
+}
+
+func TestKindFilter(t *testing.T) {
+	var kinds kindsFlag
+	for _, value := range []string{"histogram", "Counter, collector"} {
+		if err := kinds.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := kinds.String(), "histogram,counter,collector"; got != want {
+		t.Errorf("--kind=%s, want %s", got, want)
+	}
+	if err := kinds.Set("timer"); err == nil {
+		t.Error("--kind=timer is accepted")
+	}
+
+	hits := scanSource(t, map[string]string{"m.go": `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	a = prometheus.NewHistogram(prometheus.HistogramOpts{Name: "latency_seconds"})
+	b = prometheus.NewCounter(prometheus.CounterOpts{Name: "latency_total"})
+	c = prometheus.NewGauge(prometheus.GaugeOpts{Name: "latency_last_seconds"})
+)
+`}, &matchName{name: "latency"})
+	got := names(filters{kindFilter([]metricKind{counter})}.apply(hits))
+	if !slices.Equal(got, []string{"latency_total"}) {
+		t.Errorf("--kind=counter latency found %v, want [latency_total]", got)
+	}
+	got = names(filters{kindFilter([]metricKind{histogram, gauge})}.apply(hits))
+	sort.Strings(got)
+	if !slices.Equal(got, []string{"latency_last_seconds", "latency_seconds"}) {
+		t.Errorf("--kind=histogram,gauge latency found %v, want [latency_last_seconds latency_seconds]", got)
+	}
+}
+
+func TestNamespaceFilter(t *testing.T) {
+	hits := scanSource(t, map[string]string{"m.go": `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	a = prometheus.NewCounter(prometheus.CounterOpts{Namespace: "src", Name: "requests_total"})
+	b = prometheus.NewCounter(prometheus.CounterOpts{Name: "src_errors_total"})
+	c = prometheus.NewCounter(prometheus.CounterOpts{Namespace: "src_frontend", Name: "requests_total"})
+	d = prometheus.NewCounter(prometheus.CounterOpts{Namespace: "other", Name: "requests_total"})
+	e = prometheus.NewCounter(prometheus.CounterOpts{Name: "srcgraph_requests_total"})
+)
+`}, &matchAny{})
+	for _, tt := range []struct {
+		namespace string
+		prefix    bool
+		want      []string
+	}{
+		{"src", false, []string{"src_errors_total", "src_frontend_requests_total", "src_requests_total"}},
+		{"src_frontend", false, []string{"src_frontend_requests_total"}},
+		{"src", true, []string{"src_errors_total", "src_frontend_requests_total", "src_requests_total", "srcgraph_requests_total"}},
+		{"oth", false, nil},
+		{"oth", true, []string{"other_requests_total"}},
+	} {
+		got := names(filters{namespaceFilter(tt.namespace, tt.prefix)}.apply(hits))
+		sort.Strings(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("--namespace=%s (prefix %t) found %v, want %v", tt.namespace, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestSubsystemFilter(t *testing.T) {
+	hits := scanSource(t, map[string]string{"m.go": `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	a = prometheus.NewCounter(prometheus.CounterOpts{Namespace: "src", Subsystem: "gitserver", Name: "requests_total"})
+	b = prometheus.NewHistogram(prometheus.HistogramOpts{Namespace: "src", Subsystem: "gitserver", Name: "request_duration_seconds"})
+	c = prometheus.NewCounter(prometheus.CounterOpts{Namespace: "src", Subsystem: "search", Name: "requests_total"})
+	d = prometheus.NewCounter(prometheus.CounterOpts{Namespace: "src", Name: "requests_total"})
+)
+`}, &matchName{name: "request"})
+	for _, tt := range []struct {
+		subsystem string
+		want      []string
+	}{
+		{"gitserver", []string{"src_gitserver_request_duration_seconds", "src_gitserver_requests_total"}},
+		{"search", []string{"src_search_requests_total"}},
+		{"", []string{"src_requests_total"}},
+	} {
+		got := names(filters{subsystemFilter(tt.subsystem)}.apply(hits))
+		sort.Strings(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("--subsystem=%q found %v, want %v", tt.subsystem, got, tt.want)
+		}
+	}
+	got := names(filters{subsystemFilter("gitserver"), kindFilter([]metricKind{counter})}.apply(hits))
+	if !slices.Equal(got, []string{"src_gitserver_requests_total"}) {
+		t.Errorf("--subsystem=gitserver --kind=counter found %v, want [src_gitserver_requests_total]", got)
+	}
+}
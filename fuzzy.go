@@ -0,0 +1,81 @@
+package main
+
+import (
+	"go/token"
+	"strings"
+)
+
+// fuzzyCutoff is the score below which fuzzy matches are dropped.
+const fuzzyCutoff = 40
+
+// matchFuzzy matches the qualified metric names approximately, tolerating
+// typos, missing underscores and words separated by spaces.
+type matchFuzzy struct {
+	name string
+}
+
+func (mf *matchFuzzy) Match(opts promOpts, pos token.Position) (matchResult, bool) {
+	qmn := qualifiedMetricName(opts)
+	query := normalizeQuery(mf.name)
+	name := strings.ToLower(qmn)
+	if query == "" || name == "" {
+		return matchResult{}, false
+	}
+
+	// The similarity is how well the query matches the closest part of
+	// the name; half of the score is kept for how much of the name it
+	// covers, so that exact names rank above fragments.
+	d := substringDistance(query, name)
+	if d >= len(query) {
+		return matchResult{}, false
+	}
+	similarity := 100 - d*100/len(query)
+	coverage := len(query) * 100 / len(name)
+	if coverage > 100 {
+		coverage = 100
+	}
+	score := similarity * (100 + coverage) / 200
+	if score < fuzzyCutoff {
+		return matchResult{}, false
+	}
+
+	return matchResult{
+		score:  score,
+		path:   pos.Filename,
+		line:   pos.Line,
+		column: pos.Column,
+		val:    qmn,
+		help:   opts["Help"],
+	}, true
+}
+
+// normalizeQuery lowercases a query and joins its words with
+// underscores, so "gitserver fetch duration" reads as a metric name.
+func normalizeQuery(query string) string {
+	return strings.Join(splitTokens(query), "_")
+}
+
+// substringDistance is the smallest Levenshtein distance between query
+// and any substring of name.
+func substringDistance(query, name string) int {
+	// prev[j] is the distance between the query prefix and the best
+	// substring of name ending at j; it starts at zero anywhere in name.
+	prev := make([]int, len(name)+1)
+	cur := make([]int, len(name)+1)
+	for i := 1; i <= len(query); i++ {
+		cur[0] = i
+		for j := 1; j <= len(name); j++ {
+			cost := 1
+			if query[i-1] == name[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j-1]+cost, prev[j]+1, cur[j-1]+1)
+		}
+		prev, cur = cur, prev
+	}
+	best := prev[0]
+	for _, d := range prev[1:] {
+		best = min(best, d)
+	}
+	return best
+}
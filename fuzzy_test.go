@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestFuzzy(t *testing.T) {
+	src := `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	a = prometheus.NewHistogram(prometheus.HistogramOpts{Namespace: "src", Subsystem: "gitserver", Name: "fetch_duration_seconds"})
+	b = prometheus.NewHistogram(prometheus.HistogramOpts{Namespace: "src", Subsystem: "gitserver", Name: "exec_duration_seconds"})
+	c = prometheus.NewCounter(prometheus.CounterOpts{Namespace: "src", Subsystem: "frontend", Name: "requests_total"})
+)
+`
+	for _, query := range []string{"gitserver fetch duration", "src_gitserve_fetch_durations", "GitServer-Fetch"} {
+		hits := scanSource(t, map[string]string{"m.go": src}, &matchFuzzy{name: query})
+		if len(hits) == 0 {
+			t.Errorf("%s found nothing", query)
+			continue
+		}
+		best := hits[0]
+		for _, hit := range hits {
+			if hit.val == "src_frontend_requests_total" {
+				t.Errorf("%s found %s with score %d, want it dropped", query, hit.val, hit.score)
+			}
+			if hit.score > best.score {
+				best = hit
+			}
+		}
+		if best.val != "src_gitserver_fetch_duration_seconds" || best.score < fuzzyCutoff || best.score >= 100 {
+			t.Errorf("%s found %s with score %d best, want src_gitserver_fetch_duration_seconds", query, best.val, best.score)
+		}
+	}
+
+	hits := scanSource(t, map[string]string{"m.go": src}, &matchFuzzy{name: "src_gitserver_fetch_duration_seconds"})
+	for _, hit := range hits {
+		if hit.val == "src_gitserver_fetch_duration_seconds" && hit.score != 100 {
+			t.Errorf("the exact name has score %d, want 100", hit.score)
+		}
+	}
+}
+
+func TestSubstringDistance(t *testing.T) {
+	for _, tt := range []struct {
+		query, name string
+		want        int
+	}{
+		{"fetch", "src_gitserver_fetch_duration_seconds", 0},
+		{"fecth", "src_gitserver_fetch_duration_seconds", 2},
+		{"gitserve_fetch", "src_gitserver_fetch_duration_seconds", 1},
+		{"abc", "xyz", 3},
+		{"abc", "", 3},
+	} {
+		if got := substringDistance(tt.query, tt.name); got != tt.want {
+			t.Errorf("substringDistance(%q, %q) = %d, want %d", tt.query, tt.name, got, tt.want)
+		}
+	}
+}
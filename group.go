@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// groupKeys return the group of a hit for each value of --group-by.
+var groupKeys = map[string]func(hit matchResult) string{
+	"kind": func(hit matchResult) string {
+		return hit.kind.String()
+	},
+	"package": func(hit matchResult) string {
+		dir := filepath.ToSlash(filepath.Dir(hit.path))
+		if hit.pkg == "" {
+			return dir
+		}
+		return fmt.Sprintf("%s: package %s", dir, hit.pkg)
+	},
+}
+
+// groupHits splits the hits by group, keeping their order within a
+// group. The names of the groups are sorted by name in listings and by
+// their best score otherwise.
+func groupHits(hits byScore, key func(matchResult) string) ([]string, map[string]byScore) {
+	groups := make(map[string]byScore)
+	best := make(map[string]int)
+	for _, hit := range hits {
+		name := key(hit)
+		if _, ok := best[name]; !ok || hit.score > best[name] {
+			best[name] = hit.score
+		}
+		groups[name] = append(groups[name], hit)
+	}
+	names := sortedKeys(groups)
+	sort.SliceStable(names, func(i, j int) bool {
+		return best[names[i]] > best[names[j]]
+	})
+	return names, groups
+}
+
+// writeGroups prints the hits in a section per group, with the number of
+// hits in its header, and the total at the end. The hits of a group are
+// printed with write.
+func writeGroups(hits byScore, key func(matchResult) string, write func(byScore) error) error {
+	if len(hits) == 0 {
+		return nil
+	}
+
+	names, groups := groupHits(hits, key)
+	for _, name := range names {
+		group := groups[name]
+		fmt.Printf("%s (%d):\n", name, len(group))
+		if err := write(group); err != nil {
+			return err
+		}
+		fmt.Println()
+	}
+	fmt.Printf("Total: %d in %d groups\n", len(hits), len(groups))
+	return nil
+}
+
+// writeCounts prints the number of hits, or with a key, the number of
+// hits of each group and the total.
+func writeCounts(hits byScore, key func(matchResult) string) {
+	if key == nil || len(hits) == 0 {
+		fmt.Println(len(hits))
+		return
+	}
+
+	names, groups := groupHits(hits, key)
+	for _, name := range names {
+		fmt.Printf("%s: %d\n", name, len(groups[name]))
+	}
+	fmt.Printf("Total: %d\n", len(hits))
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestWriteGroups(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		key  string
+		hits byScore
+		want string
+	}{
+		{
+			name: "kind listing",
+			key:  "kind",
+			hits: byScore{
+				{listed: true, val: "up", kind: gauge},
+				{listed: true, val: "requests_total", kind: counter},
+				{listed: true, val: "jobs_total", kind: counter},
+			},
+			want: "Counter (2):\njobs_total\nrequests_total\n\nGauge (1):\nup\n\nTotal: 3 in 2 groups\n",
+		},
+		{
+			name: "kind query",
+			key:  "kind",
+			hits: byScore{
+				{score: 90, val: "requests_total", kind: counter},
+				{score: 60, val: "requests_in_flight", kind: gauge},
+				{score: 40, val: "failed_requests_total", kind: counter},
+			},
+			want: "Counter (2):\nrequests_total\nfailed_requests_total\n\nGauge (1):\nrequests_in_flight\n\nTotal: 3 in 2 groups\n",
+		},
+		{
+			name: "package listing",
+			key:  "package",
+			hits: byScore{
+				{listed: true, path: "internal/jobs/jobs.go", pkg: "jobs", val: "jobs_total"},
+				{listed: true, path: "cmd/server/main.go", pkg: "main", val: "up"},
+				{listed: true, path: "internal/jobs/queue.go", pkg: "jobs", val: "jobs_queued"},
+			},
+			want: "cmd/server: package main (1):\nup\n\ninternal/jobs: package jobs (2):\njobs_queued\njobs_total\n\nTotal: 3 in 2 groups\n",
+		},
+		{
+			name: "package query",
+			key:  "package",
+			hits: byScore{
+				{score: 90, path: "internal/jobs/jobs.go", pkg: "jobs", val: "jobs_total"},
+				{score: 60, path: "cmd/server/main.go", pkg: "main", val: "jobs_served_total"},
+				{score: 40, path: "internal/jobs/queue.go", pkg: "jobs", val: "jobs_queued"},
+			},
+			want: "internal/jobs: package jobs (2):\njobs_total\njobs_queued\n\ncmd/server: package main (1):\njobs_served_total\n\nTotal: 3 in 2 groups\n",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			order := "score"
+			if tt.hits[0].listed {
+				order = "name"
+			}
+			sortHits(tt.hits, order)
+			out := captureStdout(t, func() {
+				err := writeGroups(tt.hits, groupKeys[tt.key], func(hits byScore) error {
+					for _, name := range names(hits) {
+						fmt.Println(name)
+					}
+					return nil
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			})
+			if out != tt.want {
+				t.Errorf("printed\n%s\nwant\n%s", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestHitPackage(t *testing.T) {
+	hits := scanOne(t, `package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var up = prometheus.NewGauge(prometheus.GaugeOpts{Name: "up"})
+`)
+	if len(hits) != 1 || hits[0].pkg != "metrics" {
+		t.Errorf("got %+v, want up in package metrics", hits)
+	}
+}
+
+func TestWriteCounts(t *testing.T) {
+	hits := byScore{
+		{score: 90, val: "requests_total", kind: counter},
+		{score: 60, val: "requests_in_flight", kind: gauge},
+		{score: 40, val: "failed_requests_total", kind: counter},
+	}
+	for _, tt := range []struct {
+		name string
+		hits byScore
+		key  string
+		want string
+	}{
+		{"total", hits, "", "3\n"},
+		{"by kind", hits, "kind", "Counter: 2\nGauge: 1\nTotal: 3\n"},
+		{"none", nil, "kind", "0\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			out := captureStdout(t, func() { writeCounts(tt.hits, groupKeys[tt.key]) })
+			if out != tt.want {
+				t.Errorf("printed\n%s\nwant\n%s", out, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// htmlReport is the data of the HTML report.
+type htmlReport struct {
+	Total      int
+	Kinds      []htmlCount
+	Namespaces []htmlCount
+	Metrics    []htmlMetric
+}
+
+// htmlCount is a row of the summary tables of the HTML report.
+type htmlCount struct {
+	Name  string
+	Count int
+}
+
+// htmlMetric is a row of the table of metrics of the HTML report.
+type htmlMetric struct {
+	Anchor   string
+	Name     string
+	Kind     string
+	Labels   string
+	Help     string
+	Location string
+	// Link is the URL of the source, when --link-template is given.
+	Link string
+}
+
+// writeHTML returns a formatter printing a self-contained HTML report: the
+// number of metrics per kind and namespace, and a table of the metrics
+// that can be sorted and filtered, with an anchor per metric. The sources
+// are linked with link when it is not nil, and printed as path:line
+// otherwise.
+func writeHTML(link *template.Template) func(hits byScore) error {
+	return func(hits byScore) error {
+		kinds := make(map[string]int)
+		namespaces := make(map[string]int)
+		anchors := make(map[string]int)
+		report := htmlReport{Total: len(hits)}
+		for _, hit := range hits {
+			kinds[hit.kind.String()]++
+			namespaces[docsNamespace(hit)]++
+
+			name := hit.val
+			if hit.dynamic && hit.nameExpr != "" {
+				name = hit.nameExpr
+			}
+			anchor := "metric-" + name
+			if anchors[name]++; anchors[name] > 1 {
+				anchor += fmt.Sprintf("-%d", anchors[name])
+			}
+			metric := htmlMetric{
+				Anchor:   anchor,
+				Name:     name,
+				Kind:     hit.kind.String(),
+				Labels:   strings.ReplaceAll(docsLabels(hit), "`", ""),
+				Help:     singleLine(hit.help),
+				Location: fmt.Sprintf("%s:%d", hit.path, hit.line),
+			}
+			if link != nil {
+				var b strings.Builder
+				if err := link.Execute(&b, newTemplateHit(hit)); err != nil {
+					return err
+				}
+				metric.Link = b.String()
+			}
+			report.Metrics = append(report.Metrics, metric)
+		}
+		for _, name := range sortedKeys(kinds) {
+			report.Kinds = append(report.Kinds, htmlCount{name, kinds[name]})
+		}
+		for _, name := range sortedKeys(namespaces) {
+			report.Namespaces = append(report.Namespaces, htmlCount{name, namespaces[name]})
+		}
+		return htmlPage.Execute(os.Stdout, report)
+	}
+}
+
+// htmlPage is the template of the HTML report. Its script and style are
+// inlined so that the file can be shared alone.
+var htmlPage = htmltemplate.Must(htmltemplate.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Metrics</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+th { background: #f3f3f3; }
+#metrics th { cursor: pointer; }
+.summary { display: flex; gap: 3em; }
+code { font-size: 0.9em; }
+:target { background: #fff3b0; }
+</style>
+</head>
+<body>
+<h1>Metrics</h1>
+<p>{{.Total}} metrics.</p>
+<div class="summary">
+<table>
+<tr><th>Kind</th><th>Metrics</th></tr>
+{{- range .Kinds}}
+<tr><td>{{.Name}}</td><td>{{.Count}}</td></tr>
+{{- end}}
+</table>
+<table>
+<tr><th>Namespace</th><th>Metrics</th></tr>
+{{- range .Namespaces}}
+<tr><td>{{.Name}}</td><td>{{.Count}}</td></tr>
+{{- end}}
+</table>
+</div>
+<p><input id="filter" type="search" placeholder="Filter" size="40"></p>
+<table id="metrics">
+<thead><tr><th>Name</th><th>Kind</th><th>Labels</th><th>Help</th><th>Source</th></tr></thead>
+<tbody>
+{{- range .Metrics}}
+<tr id="{{.Anchor}}"><td><a href="#{{.Anchor}}"><code>{{.Name}}</code></a></td><td>{{.Kind}}</td><td><code>{{.Labels}}</code></td><td>{{.Help}}</td><td>{{if .Link}}<a href="{{.Link}}">{{.Location}}</a>{{else}}{{.Location}}{{end}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+<script>
+const rows = Array.from(document.querySelectorAll("#metrics tbody tr"));
+document.getElementById("filter").addEventListener("input", e => {
+  const words = e.target.value.toLowerCase().split(/\s+/).filter(w => w);
+  for (const row of rows) {
+    const text = row.textContent.toLowerCase();
+    row.hidden = !words.every(w => text.includes(w));
+  }
+});
+document.querySelectorAll("#metrics th").forEach((th, i) => {
+  let ascending = true;
+  th.addEventListener("click", () => {
+    const body = document.querySelector("#metrics tbody");
+    rows.sort((a, b) => a.cells[i].textContent.localeCompare(b.cells[i].textContent, undefined, {numeric: true}));
+    if (!ascending) rows.reverse();
+    ascending = !ascending;
+    rows.forEach(row => body.appendChild(row));
+  });
+});
+</script>
+</body>
+</html>
+`))
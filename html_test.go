@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestWriteHTML(t *testing.T) {
+	hits := byScore{
+		{path: "m.go", line: 5, val: "src_requests_total", kind: counter, help: "Requests <served>.",
+			opts: promOpts{"Namespace": "src", "Name": "requests_total"}, labels: []string{"code"}},
+		{path: "n.go", line: 7, val: "src_requests_total", kind: counter, opts: promOpts{"Namespace": "src", "Name": "requests_total"}},
+		{path: "n.go", line: 9, val: "up", kind: gauge},
+	}
+	link := template.Must(template.New("link").Parse("https://example.com/{{.Path}}#L{{.Line}}"))
+	for _, tt := range []struct {
+		name string
+		link *template.Template
+		want []string
+	}{
+		{
+			name: "plain",
+			want: []string{
+				"<p>3 metrics.</p>",
+				"<tr><td>Counter</td><td>2</td></tr>",
+				"<tr><td>Gauge</td><td>1</td></tr>",
+				"<tr><td>src</td><td>2</td></tr>",
+				`<tr id="metric-src_requests_total"><td><a href="#metric-src_requests_total"><code>src_requests_total</code></a></td><td>Counter</td><td><code>code</code></td><td>Requests &lt;served&gt;.</td><td>m.go:5</td></tr>`,
+				`<tr id="metric-src_requests_total-2">`,
+			},
+		},
+		{
+			name: "linked",
+			link: link,
+			want: []string{`<td><a href="https://example.com/n.go#L9">n.go:9</a></td>`},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			out := captureStdout(t, func() {
+				if err := writeHTML(tt.link)(hits); err != nil {
+					t.Fatal(err)
+				}
+			})
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("the report\n%s\ndoes not contain\n%s", out, want)
+				}
+			}
+		})
+	}
+}
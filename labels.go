@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// getConstLabels extracts the key/value pairs of a prometheus.Labels
+// literal. Keys and values that cannot be evaluated are kept as their
+// source text in angle brackets.
+func getConstLabels(expr ast.Expr, fi *fileInfo) map[string]string {
+	cl, ok := expr.(*ast.CompositeLit)
+	if !ok {
+		return nil
+	}
+	labels := make(map[string]string, len(cl.Elts))
+	for _, el := range cl.Elts {
+		kv, ok := el.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		labels[exprText(kv.Key, fi)] = exprText(kv.Value, fi)
+	}
+	return labels
+}
+
+// exprText returns the value of a string expression or, when it cannot
+// be evaluated, its source text as a <placeholder>.
+func exprText(expr ast.Expr, fi *fileInfo) string {
+	if val, ok := evalString(expr, fi); ok {
+		return val
+	}
+	return "<" + types.ExprString(expr) + ">"
+}
+
+// getLabelNames extracts the variable label names passed to a Vec
+// constructor, following package-level variables initialized with a
+// slice literal. When the names cannot be resolved, the source text of
+// the expression is returned instead.
+func getLabelNames(expr ast.Expr, fi *fileInfo) ([]string, string) {
+	if expr == nil {
+		return nil, ""
+	}
+	if id, ok := expr.(*ast.Ident); ok {
+		obj := fi.object(id)
+		if id.Name == "nil" && obj == nil {
+			return nil, ""
+		}
+		if val, ok := fi.values[obj]; ok && obj != nil {
+			if _, ok := val.(*ast.CompositeLit); ok {
+				return getLabelNames(val, fi)
+			}
+		}
+	}
+	cl, ok := expr.(*ast.CompositeLit)
+	if !ok {
+		return nil, types.ExprString(expr)
+	}
+	labels := make([]string, 0, len(cl.Elts))
+	for _, el := range cl.Elts {
+		labels = append(labels, exprText(el, fi))
+	}
+	return labels, ""
+}
+
+// labelsArg returns the argument holding the variable label names of a
+// constructor call, or nil if it has none.
+func labelsArg(name string, kind metricKind, c *ast.CallExpr) ast.Expr {
+	i := 1
+	switch {
+	case kind == desc:
+		i = 2
+	case strings.HasSuffix(name, "Vec"), strings.HasSuffix(name, "From"):
+	default:
+		return nil
+	}
+	if len(c.Args) <= i {
+		return nil
+	}
+	return c.Args[i]
+}
+
+// labelsShown is the number of labels printed on the line of a metric
+// before the others are elided, unless -v is given.
+const labelsShown = 6
+
+// formatLabels renders the const labels and variable label names of a
+// metric as a series selector suffix such as {component="frontend",code},
+// with const labels sorted by name followed by the variable labels in
+// declaration order. The labels in matched are emphasized. Without -v,
+// the labels past labelsShown are counted instead of listed, unless
+// they are matched.
+func formatLabels(constLabels map[string]string, labels []string, labelsExpr string, matched []string) string {
+	total := len(constLabels) + len(labels)
+	if labelsExpr != "" {
+		total++
+	}
+	elide := total > labelsShown && !*verboseFlag
+
+	pairs := make([]string, 0, total)
+	elided := 0
+	add := func(name, pair string) {
+		for _, m := range matched {
+			if m == name {
+				pairs = append(pairs, emphasize(name)+pair)
+				return
+			}
+		}
+		if elide && len(pairs) >= labelsShown {
+			elided++
+			return
+		}
+		pairs = append(pairs, name+pair)
+	}
+
+	keys := make([]string, 0, len(constLabels))
+	for k := range constLabels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		add(k, "="+strconv.Quote(constLabels[k]))
+	}
+	for _, l := range labels {
+		add(l, "")
+	}
+	if labelsExpr != "" {
+		add("<"+labelsExpr+">", "")
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	if elided > 0 {
+		pairs = append(pairs, fmt.Sprintf("+%d more", elided))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
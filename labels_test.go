@@ -0,0 +1,128 @@
+package main
+
+import (
+	"slices"
+	"sort"
+	"testing"
+)
+
+func TestConstLabels(t *testing.T) {
+	hits := scanOne(t, `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	a = prometheus.NewCounter(prometheus.CounterOpts{
+		Name:        "requests_total",
+		ConstLabels: prometheus.Labels{"component": "frontend", "zone": zone},
+	})
+	b = prometheus.NewDesc("jobs_total", "Jobs.", nil, prometheus.Labels{"queue": "default\tqueue"})
+	c = prometheus.NewGauge(prometheus.GaugeOpts{Name: "up", ConstLabels: labels})
+)
+`)
+	want := []string{
+		`requests_total{component="frontend",zone="<zone>"}`,
+		`jobs_total{queue="default\tqueue"}`,
+		`up`,
+	}
+	if len(hits) != len(want) {
+		t.Fatalf("got %v, want %v", names(hits), want)
+	}
+	for i, hit := range hits {
+		if got := hit.val + formatLabels(hit.constLabels, nil, "", nil); got != want[i] {
+			t.Errorf("got %s, want %s", got, want[i])
+		}
+	}
+}
+
+func TestLabelNames(t *testing.T) {
+	hits := scanOne(t, `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	a = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "requests_total",
+		ConstLabels: prometheus.Labels{"component": "frontend"},
+	}, []string{"method", "code"})
+	b = prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "latency_seconds"}, labelNames)
+	c = prometheus.NewDesc("jobs_total", "Jobs.", []string{"queue"}, nil)
+	d = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "inflight"}, nil)
+	e = prometheus.NewCounter(prometheus.CounterOpts{Name: "errors_total"})
+)
+`)
+	want := []string{
+		`requests_total{component="frontend",method,code}`,
+		`latency_seconds{<labelNames>}`,
+		`jobs_total{queue}`,
+		`inflight`,
+		`errors_total`,
+	}
+	if len(hits) != len(want) {
+		t.Fatalf("got %v, want %v", names(hits), want)
+	}
+	for i, hit := range hits {
+		if got := hit.val + formatLabels(hit.constLabels, hit.labels, hit.labelsExpr, nil); got != want[i] {
+			t.Errorf("got %s, want %s", got, want[i])
+		}
+	}
+}
+
+func TestLabelFilter(t *testing.T) {
+	hits := scanSource(t, map[string]string{"m.go": `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	a = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "repo_requests_total"}, []string{"repo", "code"})
+	b = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "repo_size_bytes", ConstLabels: prometheus.Labels{"repo": "x"}}, []string{"shard"})
+	c = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "requests_total"}, []string{"code"})
+)
+`}, &matchName{name: "repo"})
+	for _, tt := range []struct {
+		labels []string
+		want   []string
+	}{
+		{[]string{"repo"}, []string{"repo_requests_total", "repo_size_bytes"}},
+		{[]string{"repo", "code"}, []string{"repo_requests_total"}},
+		{[]string{"code"}, []string{"repo_requests_total"}},
+		{[]string{"missing"}, nil},
+	} {
+		got := names(filters{labelsFilter(tt.labels)}.apply(hits))
+		sort.Strings(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("--label %v found %v, want %v", tt.labels, got, tt.want)
+		}
+	}
+
+	setFlag(t, &colorOutput, true)
+	got := formatLabels(map[string]string{"repo": "x"}, []string{"shard", "code"}, "", []string{"repo", "code"})
+	if want := "{\x1b[1mrepo\x1b[0m=\"x\",shard,\x1b[1mcode\x1b[0m}"; got != want {
+		t.Errorf("formatLabels() = %q, want %q", got, want)
+	}
+}
+
+func TestFormatLabels(t *testing.T) {
+	labels := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	for _, tt := range []struct {
+		name        string
+		constLabels map[string]string
+		labels      []string
+		matched     []string
+		verbose     bool
+		want        string
+	}{
+		{name: "none", want: ""},
+		{name: "short", constLabels: map[string]string{"component": "frontend"}, labels: []string{"code"}, want: `{component="frontend",code}`},
+		{name: "elided", labels: labels, want: "{a,b,c,d,e,f,+2 more}"},
+		{name: "matched", labels: labels, matched: []string{"h"}, want: "{a,b,c,d,e,f,h,+1 more}"},
+		{name: "verbose", labels: labels, verbose: true, want: "{a,b,c,d,e,f,g,h}"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, verboseFlag, tt.verbose)
+			if got := formatLabels(tt.constLabels, tt.labels, "", tt.matched); got != tt.want {
+				t.Errorf("formatLabels() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
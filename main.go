@@ -1,15 +1,19 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"go/ast"
 	"go/parser"
 	"go/token"
+	"go/types"
 	"log"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"text/template"
 )
 
 type metricKind int
@@ -18,27 +22,151 @@ const (
 	gauge metricKind = iota
 	histogram
 	counter
+	summary
+	untyped
+	desc
+	collector
+	recordingRule
 )
 
 func (kind metricKind) String() string {
 	switch kind {
-	case gauge: return "Gauge"
-	case histogram: return "Histogram"
-	case counter: return "Counter"
+	case gauge:
+		return "Gauge"
+	case histogram:
+		return "Histogram"
+	case counter:
+		return "Counter"
+	case summary:
+		return "Summary"
+	case untyped:
+		return "Untyped"
+	case desc:
+		return "Desc"
+	case collector:
+		return "Collector"
+	case recordingRule:
+		return "RecordingRule"
 	}
 	return ""
 }
 
+// parseKind is the inverse of metricKind.String, ignoring case.
+func parseKind(name string) (metricKind, bool) {
+	for kind := gauge; kind <= recordingRule; kind++ {
+		if strings.EqualFold(kind.String(), name) {
+			return kind, true
+		}
+	}
+	return 0, false
+}
+
+// kindsFlag is a flag of metric kinds, comma-separated or repeated.
+type kindsFlag []metricKind
+
+func (f *kindsFlag) String() string {
+	names := make([]string, len(*f))
+	for i, kind := range *f {
+		names[i] = strings.ToLower(kind.String())
+	}
+	return strings.Join(names, ",")
+}
+
+func (f *kindsFlag) Set(value string) error {
+	for _, name := range strings.Split(value, ",") {
+		kind, ok := parseKind(strings.TrimSpace(name))
+		if !ok {
+			return fmt.Errorf("unknown metric kind %q", name)
+		}
+		*f = append(*f, kind)
+	}
+	return nil
+}
+
 type promOpts map[string]string
 
 type matchResult struct {
 	// score is in range [0..100], bigger is better match, 100 is perfect match
 	score int
-	path string
-	val string
-	help string
-	line int
-	kind metricKind
+	// listed is set for the hits of a listing without a query, which are
+	// not scored.
+	listed bool
+	path   string
+	val    string
+	// dynamic is set when the name is not fully known statically, and
+	// nameExpr holds the Go expressions it is built from.
+	dynamic  bool
+	nameExpr string
+	// query is the query the hit matched when there are several.
+	query string
+	// matched are the start and end offsets of the part of val the query
+	// matched, when the matcher tells.
+	matched []int
+	// series is the suffix of the histogram or summary series the query
+	// names, such as "_bucket", when it matches through it.
+	series string
+	// plain is the match of the query as written, when it matched
+	// better through the suffix of a series. It stands in for the hit
+	// when the kind of metric does not expose the series.
+	plain *matchResult
+	// ruleQuery is set when the query looks like the name of a recording
+	// rule and the hit matches the series it is derived from.
+	ruleQuery bool
+	// queryScores are the scores of the hit for each query read with
+	// --queries, -1 for the queries it does not match.
+	queryScores []int
+	// declaredName is the name in the Opts when the registerer changes
+	// it, val being the name that is scraped.
+	declaredName string
+	// derivedFrom describes the series a recording rule is computed
+	// from, and where they are declared.
+	derivedFrom string
+	help        string
+	line        int
+	// pkg is the name of the Go package declaring the metric.
+	pkg string
+	// endLine is the last line of the call declaring the metric, and
+	// column the column where it starts.
+	endLine int
+	column  int
+	kind    metricKind
+	opts    promOpts
+	// buckets are the evaluated bucket boundaries of a histogram, or
+	// bucketsExpr the source of Buckets when they could not be evaluated.
+	buckets     []float64
+	bucketsExpr string
+	// objectives are the quantile objectives of a summary, or
+	// objectivesExpr the source of Objectives when they could not be
+	// evaluated. maxAge is the summary's MaxAge as a duration string.
+	objectives     map[float64]float64
+	objectivesExpr string
+	maxAge         string
+	constLabels    map[string]string
+	// labels are the variable label names of a Vec, or labelsExpr the
+	// source of the label names argument when it is not a literal.
+	labels     []string
+	labelsExpr string
+	// registrations are where the metric is registered. Metrics created
+	// with promauto have a single registration at their declaration.
+	registrations []registration
+	// varName is the variable the metric is assigned to and funcName the
+	// function declaring it, if any.
+	varName  string
+	funcName string
+	// declKind classifies where the metric is created: "package-var",
+	// "init", "once" or "func Name".
+	declKind string
+	// structType and fieldName are the struct and field the metric is
+	// stored in, if any.
+	structType string
+	fieldName  string
+	// generated is set for metrics declared in generated files.
+	generated bool
+	// test is set for metrics declared in _test.go files.
+	test bool
+	// constMetric is set for the samples a collector emits for a Desc,
+	// with NewConstMetric and the like.
+	constMetric bool
 }
 
 type byScore []matchResult
@@ -55,94 +183,559 @@ type matchAny struct{}
 
 func (ma *matchAny) Match(opts promOpts, pos token.Position) (matchResult, bool) {
 	return matchResult{
-		score: -1,
-		path:  pos.Filename,
-		line:  pos.Line,
-		help:  opts["Help"],
-		val: qualifiedMetricName(opts),
+		listed: true,
+		path:   pos.Filename,
+		line:   pos.Line,
+		column: pos.Column,
+		help:   opts["Help"],
+		val:    qualifiedMetricName(opts),
 	}, true
 }
 
 type matchName struct {
-	name string
+	name       string
+	ignoreCase bool
+	// prefix and suffix anchor the name at the start or the end of the
+	// qualified names, as ^ and $ in the query do.
+	prefix, suffix bool
 }
 
 func (mn *matchName) Match(opts promOpts, pos token.Position) (matchResult, bool) {
+	if mn.ignoreCase {
+		// Matching the lowercased names gives the score of a correctly
+		// cased query, and the offsets of the match in the names.
+		hit, ok := (&matchName{name: foldCase(mn.name), prefix: mn.prefix, suffix: mn.suffix}).Match(lowerOpts(opts), pos)
+		hit.val, hit.help = qualifiedMetricName(opts), opts["Help"]
+		return hit, ok
+	}
+
+	// A query for a series of a histogram or a summary matches the
+	// metric as well as its name would.
+	hit, ok := mn.match(opts, pos)
+	if series := seriesSuffix(mn.name); series != "" {
+		base := &matchName{name: strings.TrimSuffix(mn.name, series), prefix: mn.prefix, suffix: mn.suffix}
+		if baseHit, baseOk := base.match(opts, pos); baseOk && (!ok || baseHit.score > hit.score) {
+			baseHit.series = series
+			if ok {
+				plain := hit
+				baseHit.plain = &plain
+			}
+			hit, ok = baseHit, true
+		}
+	}
+
+	// Recording rule names such as job:src_requests:rate5m never match
+	// as written, but the series they are derived from may, with the
+	// same case and anchors as the query.
+	if segment := ruleSegment(mn.name); segment != "" {
+		segMatcher := &matchName{name: segment, ignoreCase: mn.ignoreCase, prefix: mn.prefix, suffix: mn.suffix}
+		if segHit, segOk := segMatcher.Match(opts, pos); segOk && (!ok || segHit.score > hit.score) {
+			segHit.ruleQuery = true
+			hit, ok = segHit, true
+		}
+	}
+	return hit, ok
+}
+
+// match matches a query as written against the qualified name.
+func (mn *matchName) match(opts promOpts, pos token.Position) (matchResult, bool) {
+	if mn.prefix || mn.suffix {
+		qmn := qualifiedMetricName(opts)
+		if qmn == "" || (mn.prefix && !strings.HasPrefix(qmn, mn.name)) || (mn.suffix && !strings.HasSuffix(qmn, mn.name)) ||
+			(mn.prefix && mn.suffix && qmn != mn.name) {
+			return matchResult{}, false
+		}
+		start := 0
+		if !mn.prefix {
+			start = len(qmn) - len(mn.name)
+		}
+		return matchResult{
+			score:   len(mn.name) * 100 / len(qmn),
+			path:    pos.Filename,
+			line:    pos.Line,
+			column:  pos.Column,
+			val:     qmn,
+			help:    opts["Help"],
+			matched: []int{start, start + len(mn.name)},
+		}, true
+	}
 	if opts["Namespace"] != "" && opts["Subsystem"] == "" &&
-		len(mn.name) > (len(opts["Namespace"]) + len(opts["Name"])) {
+		len(mn.name) > (len(opts["Namespace"])+len(opts["Name"])) {
 		if !strings.HasPrefix(mn.name, opts["Namespace"]) || !strings.HasSuffix(mn.name, opts["Name"]) {
 			return matchResult{}, false
 		}
 
-		delta, denum := len(mn.name) - len(opts["Namespace"]) - len(opts["Name"]), len(mn.name)
-		score := 100 - delta * 100 / denum
+		delta, denum := len(mn.name)-len(opts["Namespace"])-len(opts["Name"]), len(mn.name)
+		score := 100 - delta*100/denum
 		return matchResult{
-			score: score,
-			path:  pos.Filename,
-			line:  pos.Line,
-			val:   qualifiedMetricName(opts),
-			help:  opts["Help"],
+			score:  score,
+			path:   pos.Filename,
+			line:   pos.Line,
+			column: pos.Column,
+			val:    qualifiedMetricName(opts),
+			help:   opts["Help"],
 		}, true
 	}
 	qmn := qualifiedMetricName(opts)
 
-	if !strings.Contains(mn.name, qmn) && !strings.Contains(qmn, mn.name){
+	if placeholder.MatchString(qmn) && mn.name != "" {
+		covered, ok := matchFragments(mn.name, qmn)
+		if !ok {
+			return matchResult{}, false
+		}
+		return matchResult{
+			score:  covered * 100 / len(mn.name),
+			path:   pos.Filename,
+			line:   pos.Line,
+			column: pos.Column,
+			val:    qmn,
+			help:   opts["Help"],
+		}, true
+	}
+
+	// A name that is not known at all has nothing to match against.
+	if qmn == "" {
 		return matchResult{}, false
 	}
 
-	delta, denum := len(mn.name) - len(qmn), len(mn.name)
+	if !strings.Contains(mn.name, qmn) && !strings.Contains(qmn, mn.name) {
+		return matchResult{}, false
+	}
+
+	delta, denum := len(mn.name)-len(qmn), len(mn.name)
 	if delta < 0 {
 		delta, denum = -delta, len(qmn)
 	}
 
-	score := 100 - delta * 100 / denum
+	matched := []int{0, len(qmn)}
+	if i := strings.Index(qmn, mn.name); i >= 0 {
+		matched = []int{i, i + len(mn.name)}
+	}
+
+	score := 100 - delta*100/denum
 	return matchResult{
-		score: score,
-		path:  pos.Filename,
-		line:  pos.Line,
-		val:   qualifiedMetricName(opts),
-		help:  opts["Help"],
+		score:   score,
+		path:    pos.Filename,
+		line:    pos.Line,
+		column:  pos.Column,
+		val:     qualifiedMetricName(opts),
+		help:    opts["Help"],
+		matched: matched,
 	}, true
 }
 
-func getCallExprLiteral(c *ast.CallExpr) string {
-	s, ok := c.Fun.(*ast.SelectorExpr)
+// fileInfo holds what is learned about a file in a pass over its AST
+// before the constructor calls are inspected.
+type fileInfo struct {
+	*pkgInfo
+	// factories are the variables assigned from promauto.With(...), mapped
+	// to the registerer passed to With.
+	factories map[types.Object]ast.Expr
+	// targets are the variables constructor calls are assigned to.
+	targets map[*ast.CallExpr]*ast.Ident
+	// fields are the struct fields constructor calls are stored in.
+	fields map[*ast.CallExpr]structField
+	// descs are the variables assigned from prometheus.NewDesc(...).
+	descs map[types.Object]*ast.CallExpr
+	// imports maps the local names of imported client packages to their
+	// names in clientPackages.
+	imports map[string]string
+	// dotImport is the name of the client package imported with
+	// import . "...", if any.
+	dotImport string
+	// decls are the top-level declarations of the file.
+	decls []ast.Decl
+	// generated is set for files with a "Code generated ... DO NOT EDIT."
+	// header.
+	generated bool
+	// test is set for _test.go files.
+	test bool
+	// info is the type information of the package in --typed mode.
+	info *types.Info
+}
+
+// pkgInfo holds what is shared by the files of a package.
+type pkgInfo struct {
+	// values are the initializers of the variables and constants declared
+	// in the package. Later assignments are not tracked.
+	values map[types.Object]ast.Expr
+	// registrations are the calls registering metrics, keyed by the
+	// types.Object of the variable holding the metric or by the
+	// *ast.CallExpr of a constructor registered directly.
+	registrations map[interface{}][]registration
+	// objects resolves the identifiers of the files to the objects they
+	// denote, and types is the package declaring them.
+	objects *types.Info
+	types   *types.Package
+	// declarations are the declarations of the objects of the package:
+	// the *ast.FuncDecl of functions, the *ast.Field of parameters and
+	// the *ast.ValueSpec or *ast.AssignStmt of variables and constants.
+	declarations map[types.Object]ast.Node
+}
+
+// newPkgInfo returns the pkgInfo of the files of pkg, whose identifiers
+// are resolved by info.
+func newPkgInfo(pkg *types.Package, info *types.Info, files []*ast.File) *pkgInfo {
+	pi := &pkgInfo{
+		values:        make(map[types.Object]ast.Expr),
+		registrations: make(map[interface{}][]registration),
+		objects:       info,
+		types:         pkg,
+		declarations:  make(map[types.Object]ast.Node),
+	}
+	declare := func(id *ast.Ident, decl ast.Node) {
+		if obj := info.Defs[id]; obj != nil {
+			pi.declarations[obj] = decl
+		}
+	}
+	for _, file := range files {
+		ast.Inspect(file, func(node ast.Node) bool {
+			switch n := node.(type) {
+			case *ast.FuncDecl:
+				declare(n.Name, n)
+			case *ast.Field:
+				for _, name := range n.Names {
+					declare(name, n)
+				}
+			case *ast.ValueSpec:
+				for _, name := range n.Names {
+					declare(name, n)
+				}
+			case *ast.AssignStmt:
+				if n.Tok != token.DEFINE {
+					break
+				}
+				for _, lhs := range n.Lhs {
+					if id, ok := lhs.(*ast.Ident); ok {
+						declare(id, n)
+					}
+				}
+			}
+			return true
+		})
+	}
+	return pi
+}
+
+// clientPackages maps the import paths of the client packages to the names
+// their functions are keyed by in constructors.
+var clientPackages = map[string]string{
+	"github.com/prometheus/client_golang/prometheus":            "prometheus",
+	"github.com/prometheus/client_golang/prometheus/promauto":   "promauto",
+	"github.com/prometheus/client_golang/prometheus/collectors": "collectors",
+	"github.com/go-kit/kit/metrics/prometheus":                  "kitprometheus",
+	"k8s.io/component-base/metrics":                             "k8smetrics",
+	"github.com/VictoriaMetrics/metrics":                        "vmmetrics",
+	"github.com/sourcegraph/sourcegraph/internal/metrics":       "metrics",
+}
+
+// clientPackage returns the name a client package is known by in
+// constructors. Forks and mirrors of client_golang are recognized by the
+// trailing elements of their import path.
+func clientPackage(importPath string) (string, bool) {
+	if pkg, ok := clientPackages[importPath]; ok {
+		return pkg, true
+	}
+	for _, suffix := range []string{"/client_golang/prometheus", "/client_golang/prometheus/promauto", "/client_golang/prometheus/collectors"} {
+		if strings.HasSuffix(importPath, suffix) {
+			return clientPackages["github.com/prometheus"+suffix], true
+		}
+	}
+	return "", false
+}
+
+// collectFileInfo records what is declared in tree into a fileInfo and
+// the pkgInfo of its package.
+func collectFileInfo(tree *ast.File, pkg *pkgInfo) *fileInfo {
+	fi := &fileInfo{
+		pkgInfo:   pkg,
+		factories: make(map[types.Object]ast.Expr),
+		targets:   make(map[*ast.CallExpr]*ast.Ident),
+		fields:    make(map[*ast.CallExpr]structField),
+		descs:     make(map[types.Object]*ast.CallExpr),
+		imports:   make(map[string]string),
+		decls:     tree.Decls,
+		generated: ast.IsGenerated(tree),
+	}
+
+	for _, ispec := range tree.Imports {
+		importPath := unquote(ispec.Path.Value)
+		pkg, ok := clientPackage(importPath)
+		if !ok {
+			continue
+		}
+		local := importPath[strings.LastIndex(importPath, "/")+1:]
+		if ispec.Name != nil {
+			local = ispec.Name.Name
+		}
+		if local == "." {
+			fi.dotImport = pkg
+			continue
+		}
+		fi.imports[local] = pkg
+	}
+
+	record := func(lhs []ast.Expr, rhs []ast.Expr, define bool) {
+		if len(lhs) != len(rhs) {
+			return
+		}
+		for i, expr := range rhs {
+			if sel, ok := lhs[i].(*ast.SelectorExpr); ok {
+				if c, ok := expr.(*ast.CallExpr); ok {
+					fi.fields[c] = structField{typ: structTypeOf(sel.X, fi), name: sel.Sel.Name}
+				}
+				continue
+			}
+			id, ok := lhs[i].(*ast.Ident)
+			if !ok {
+				continue
+			}
+			obj := fi.object(id)
+			if obj == nil {
+				continue
+			}
+			if define {
+				fi.values[obj] = expr
+			}
+			c, ok := expr.(*ast.CallExpr)
+			if !ok {
+				continue
+			}
+			fi.targets[c] = id
+			switch getCallExprLiteral(c, fi) {
+			case "promauto.With":
+				if len(c.Args) == 1 {
+					fi.factories[obj] = c.Args[0]
+				}
+			case "prometheus.NewDesc":
+				fi.descs[obj] = c
+			}
+		}
+	}
+
+	ast.Inspect(tree, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.AssignStmt:
+			record(n.Lhs, n.Rhs, n.Tok == token.DEFINE)
+		case *ast.ValueSpec:
+			lhs := make([]ast.Expr, len(n.Names))
+			for i, name := range n.Names {
+				lhs[i] = name
+			}
+			record(lhs, n.Values, true)
+		case *ast.CompositeLit:
+			recordFields(n, fi)
+		case *ast.CallExpr:
+			recordRegistration(n, fi)
+		}
+		return true
+	})
+	return fi
+}
+
+func getCallExprLiteral(c *ast.CallExpr, fi *fileInfo) string {
+	return getSelectorLiteral(c.Fun, fi)
+}
+
+// getSelectorLiteral renders pkg.Name selectors with pkg replaced by the
+// package name it is known by in constructors, regardless of how the
+// file imports it.
+func getSelectorLiteral(expr ast.Expr, fi *fileInfo) string {
+	if fi.info != nil {
+		if lit := typedSelectorLiteral(expr, fi.info); lit != "" {
+			return lit
+		}
+	}
+
+	// Unqualified identifiers that are not declared in the file may come
+	// from a dot-imported client package.
+	if id, ok := expr.(*ast.Ident); ok {
+		if fi.dotImport == "" || fi.object(id) != nil {
+			return ""
+		}
+		return fi.dotImport + "." + id.Name
+	}
+
+	s, ok := expr.(*ast.SelectorExpr)
 	if !ok {
 		return ""
 	}
 
+	// promauto.With(reg).NewCounterVec(...) declares the same metric as
+	// promauto.NewCounterVec(...), only on a different registerer.
+	if inner, ok := s.X.(*ast.CallExpr); ok {
+		if getCallExprLiteral(inner, fi) != "promauto.With" {
+			return ""
+		}
+		return "promauto." + s.Sel.Name
+	}
+
 	i, ok := s.X.(*ast.Ident)
 	if !ok {
 		return ""
 	}
 
+	// Same for factory := promauto.With(reg); factory.NewCounterVec(...).
+	obj := fi.object(i)
+	if _, ok := fi.factories[obj]; ok && obj != nil {
+		return "promauto." + s.Sel.Name
+	}
+
+	if pkg, ok := fi.imports[i.Name]; ok && obj == nil {
+		return pkg + "." + s.Sel.Name
+	}
+
 	return i.Name + "." + s.Sel.Name
 }
 
+// unquote decodes a Go string literal, returning val as is when it is
+// not one.
 func unquote(val string) string {
-	n := len(val)
-	if n < 2 || val[0] != '"' || val[n-1] != '"' {
+	s, err := strconv.Unquote(val)
+	if err != nil {
 		return val
 	}
-	return val[1:n-1]
+	return s
 }
 
+// qualifiedMetricName joins the non-empty Namespace, Subsystem and Name
+// with underscores, as prometheus.BuildFQName does. The name is empty
+// when Name is.
 func qualifiedMetricName(opts promOpts) string {
-	qmn := opts["Name"]
+	if opts["Name"] == "" {
+		return ""
+	}
+	var parts []string
+	for _, key := range []string{"Namespace", "Subsystem", "Name"} {
+		if opts[key] != "" {
+			parts = append(parts, opts[key])
+		}
+	}
+	return strings.Join(parts, "_")
+}
+
+// optsLiteral returns the Opts composite literal passed as the first
+// argument of a constructor, either inline or through a variable
+// initialized with it.
+func optsLiteral(c *ast.CallExpr, fi *fileInfo) *ast.CompositeLit {
+	if len(c.Args) == 0 {
+		return nil
+	}
+	return resolveOpts(c.Args[0], fi)
+}
 
-	if opts["Subsystem"] != "" {
-		qmn = opts["Subsystem"] + "_" + qmn
+// optsTypes are the Opts types whose conversions, such as
+// prometheus.CounterOpts(opts), are looked through.
+var optsTypes = map[string]bool{
+	"prometheus.Opts":          true,
+	"prometheus.CounterOpts":   true,
+	"prometheus.GaugeOpts":     true,
+	"prometheus.HistogramOpts": true,
+	"prometheus.SummaryOpts":   true,
+	"prometheus.UntypedOpts":   true,
+}
+
+func resolveOpts(expr ast.Expr, fi *fileInfo) *ast.CompositeLit {
+	if id, ok := expr.(*ast.Ident); ok {
+		if obj := fi.object(id); obj != nil {
+			expr = fi.values[obj]
+		}
 	}
-	if opts["Namespace"] != "" && opts["Subsystem"] != "" {
-		qmn = opts["Namespace"] + "_" + qmn
+	// component-base/metrics takes a pointer to its Opts.
+	if u, ok := expr.(*ast.UnaryExpr); ok && u.Op == token.AND {
+		expr = u.X
 	}
-	return qmn
+	if call, ok := expr.(*ast.CallExpr); ok {
+		if optsTypes[getCallExprLiteral(call, fi)] && len(call.Args) == 1 {
+			return resolveOpts(call.Args[0], fi)
+		}
+		return helperLiteral(call, fi)
+	}
+	cl, _ := expr.(*ast.CompositeLit)
+	return cl
 }
 
-func getOpts(c *ast.CallExpr) promOpts {
-	opts := make(promOpts)
-	cl, ok := c.Args[0].(*ast.CompositeLit)
+// helperLiteral resolves a call to a function declared in the package
+// whose body is a single return of a composite literal, such as
+//
+//	func counterOpts(name string) prometheus.CounterOpts {
+//		return prometheus.CounterOpts{Namespace: "src", Name: name}
+//	}
+//
+// Fields set directly from a parameter are substituted with the
+// corresponding argument of the call.
+func helperLiteral(call *ast.CallExpr, fi *fileInfo) *ast.CompositeLit {
+	id, ok := call.Fun.(*ast.Ident)
+	if !ok {
+		return nil
+	}
+	fd, ok := fi.declarations[fi.object(id)].(*ast.FuncDecl)
+	if !ok || fd.Body == nil || len(fd.Body.List) != 1 {
+		return nil
+	}
+	ret, ok := fd.Body.List[0].(*ast.ReturnStmt)
+	if !ok || len(ret.Results) != 1 {
+		return nil
+	}
+	cl, ok := ret.Results[0].(*ast.CompositeLit)
 	if !ok {
+		return nil
+	}
+
+	args := make(map[types.Object]ast.Expr)
+	i := 0
+	for _, field := range fd.Type.Params.List {
+		if _, ok := field.Type.(*ast.Ellipsis); ok {
+			break
+		}
+		for _, name := range field.Names {
+			if obj := fi.object(name); i < len(call.Args) && obj != nil {
+				args[obj] = call.Args[i]
+			}
+			i++
+		}
+	}
+
+	subst := *cl
+	subst.Elts = make([]ast.Expr, len(cl.Elts))
+	for i, el := range cl.Elts {
+		subst.Elts[i] = el
+		kv, ok := el.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		if param, ok := kv.Value.(*ast.Ident); ok {
+			if arg, ok := args[fi.object(param)]; ok {
+				subst.Elts[i] = &ast.KeyValueExpr{Key: kv.Key, Colon: kv.Colon, Value: arg}
+			}
+		}
+	}
+	return &subst
+}
+
+// optsField returns the value of the named field in the Opts composite
+// literal of a constructor, or nil.
+func optsField(c *ast.CallExpr, name string, fi *fileInfo) ast.Expr {
+	cl := optsLiteral(c, fi)
+	if cl == nil {
+		return nil
+	}
+	for _, el := range cl.Elts {
+		kv, ok := el.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		if key, ok := kv.Key.(*ast.Ident); ok && key.Name == name {
+			return kv.Value
+		}
+	}
+	return nil
+}
+
+func getOpts(c *ast.CallExpr, fi *fileInfo) promOpts {
+	opts := make(promOpts)
+	cl := optsLiteral(c, fi)
+	if cl == nil {
 		return opts
 	}
 	for _, el := range cl.Elts {
@@ -156,6 +749,19 @@ func getOpts(c *ast.CallExpr) promOpts {
 		}
 		val, ok := kv.Value.(*ast.BasicLit)
 		if !ok {
+			// Identifiers, concatenations and Sprintf calls keep their
+			// resolved parts and placeholders for the others, so that
+			// they can still be matched partially.
+			v, resolved := evalString(kv.Value, fi)
+			if resolved || v != "?" {
+				opts[key.Name] = v
+				continue
+			}
+			// Durations such as NativeHistogramMinResetDuration are
+			// rarely literals; keep their source text instead.
+			if nativeHistogramFields[key.Name] || key.Name == "StabilityLevel" {
+				opts[key.Name] = types.ExprString(kv.Value)
+			}
 			continue
 		}
 
@@ -164,116 +770,922 @@ func getOpts(c *ast.CallExpr) promOpts {
 	return opts
 }
 
-var constructors = map[string]metricKind {
-	"prometheus.NewCounterVec": counter,
-	"prometheus.NewCounter": counter,
-	"prometheus.NewHistogramVec": histogram,
-	"prometheus.NewHistogram": histogram,
-	"prometheus.NewGaugeVec": gauge,
-	"prometheus.NewGauge": gauge,
-	"promauto.NewCounterVec": counter,
-	"promauto.NewCounter": counter,
-	"promauto.NewHistogramVec": histogram,
-	"promauto.NewHistogram": histogram,
-	"promauto.NewGaugeVec": gauge,
-	"promauto.NewGauge": gauge,
+// nativeHistogramFields are the HistogramOpts fields configuring native
+// histograms.
+var nativeHistogramFields = map[string]bool{
+	"NativeHistogramBucketFactor":     true,
+	"NativeHistogramZeroThreshold":    true,
+	"NativeHistogramMaxBucketNumber":  true,
+	"NativeHistogramMinResetDuration": true,
+	"NativeHistogramMaxZeroThreshold": true,
+}
+
+// nativeHistogramSettings renders the native histogram fields set in
+// opts, or "" when the histogram does not configure any.
+func nativeHistogramSettings(opts promOpts) string {
+	var settings []string
+	for key, val := range opts {
+		if nativeHistogramFields[key] {
+			settings = append(settings, key+"="+val)
+		}
+	}
+	sort.Strings(settings)
+	return strings.Join(settings, " ")
+}
+
+// getDescOpts extracts the name and help of a metric described by
+// prometheus.NewDesc(fqName, help, variableLabels, constLabels).
+func getDescOpts(c *ast.CallExpr, fi *fileInfo) promOpts {
+	opts := make(promOpts)
+	if len(c.Args) < 2 {
+		return opts
+	}
+	opts["Name"] = getFQName(c.Args[0], fi)
+	if help, ok := evalString(c.Args[1], fi); ok {
+		opts["Help"] = help
+	}
+	// component-base/metrics.NewDesc also takes the stability level and
+	// deprecated version.
+	if len(c.Args) == 6 {
+		opts["StabilityLevel"] = types.ExprString(c.Args[4])
+		if version, ok := evalString(c.Args[5], fi); ok {
+			opts["DeprecatedVersion"] = version
+		}
+	}
+	return opts
+}
+
+// getFQName evaluates a fully qualified metric name given either as a
+// string expression or as prometheus.BuildFQName(namespace, subsystem,
+// name).
+func getFQName(expr ast.Expr, fi *fileInfo) string {
+	e, ok := expr.(*ast.CallExpr)
+	if !ok || getCallExprLiteral(e, fi) != "prometheus.BuildFQName" || len(e.Args) != 3 {
+		name, _ := evalString(expr, fi)
+		return name
+	}
+
+	var parts []string
+	for _, arg := range e.Args {
+		if v, _ := evalString(arg, fi); v != "" {
+			parts = append(parts, v)
+		}
+	}
+	// BuildFQName returns an empty string when name is empty.
+	if name, _ := evalString(e.Args[2], fi); name == "" {
+		return ""
+	}
+	return strings.Join(parts, "_")
+}
+
+// getConstMetricOpts resolves the Desc passed to a const metric
+// constructor. When the Desc is a variable that cannot be traced back to
+// a prometheus.NewDesc call in the same file, the variable name stands in
+// for the metric name.
+func getConstMetricOpts(c *ast.CallExpr, fi *fileInfo) promOpts {
+	if len(c.Args) == 0 {
+		return make(promOpts)
+	}
+	switch d := c.Args[0].(type) {
+	case *ast.Ident:
+		if descCall, ok := fi.descs[fi.object(d)]; ok {
+			return getDescOpts(descCall, fi)
+		}
+	case *ast.CallExpr:
+		if getCallExprLiteral(d, fi) == "prometheus.NewDesc" {
+			return getDescOpts(d, fi)
+		}
+	}
+	return promOpts{"Name": types.ExprString(c.Args[0])}
+}
+
+// valueTypes maps the prometheus.ValueType argument of NewConstMetric
+// to the kind of the emitted metric.
+var valueTypes = map[string]metricKind{
+	"prometheus.CounterValue": counter,
+	"prometheus.GaugeValue":   gauge,
+	"prometheus.UntypedValue": untyped,
+}
+
+// constMetrics are the calls collectors use to emit samples for a Desc.
+var constMetrics = map[string]metricKind{
+	"prometheus.NewConstMetric":        untyped,
+	"prometheus.MustNewConstMetric":    untyped,
+	"prometheus.NewConstHistogram":     histogram,
+	"prometheus.MustNewConstHistogram": histogram,
+	"prometheus.NewConstSummary":       summary,
+	"prometheus.MustNewConstSummary":   summary,
+}
+
+var constructors = map[string]metricKind{
+	"prometheus.NewCounterVec":       counter,
+	"prometheus.NewCounter":          counter,
+	"prometheus.NewHistogramVec":     histogram,
+	"prometheus.NewHistogram":        histogram,
+	"prometheus.NewGaugeVec":         gauge,
+	"prometheus.NewGauge":            gauge,
+	"prometheus.NewSummaryVec":       summary,
+	"prometheus.NewSummary":          summary,
+	"prometheus.NewCounterFunc":      counter,
+	"prometheus.NewGaugeFunc":        gauge,
+	"prometheus.NewUntypedFunc":      untyped,
+	"promauto.NewCounterVec":         counter,
+	"promauto.NewCounter":            counter,
+	"promauto.NewHistogramVec":       histogram,
+	"promauto.NewHistogram":          histogram,
+	"promauto.NewGaugeVec":           gauge,
+	"promauto.NewGauge":              gauge,
+	"promauto.NewSummaryVec":         summary,
+	"promauto.NewSummary":            summary,
+	"promauto.NewCounterFunc":        counter,
+	"promauto.NewGaugeFunc":          gauge,
+	"promauto.NewUntypedFunc":        untyped,
+	"prometheus.NewDesc":             desc,
+	"kitprometheus.NewCounterFrom":   counter,
+	"kitprometheus.NewGaugeFrom":     gauge,
+	"kitprometheus.NewHistogramFrom": histogram,
+	"kitprometheus.NewSummaryFrom":   summary,
+	"k8smetrics.NewCounter":          counter,
+	"k8smetrics.NewCounterVec":       counter,
+	"k8smetrics.NewGauge":            gauge,
+	"k8smetrics.NewGaugeVec":         gauge,
+	"k8smetrics.NewGaugeFunc":        gauge,
+	"k8smetrics.NewHistogram":        histogram,
+	"k8smetrics.NewHistogramVec":     histogram,
+	"k8smetrics.NewSummary":          summary,
+	"k8smetrics.NewSummaryVec":       summary,
+	"k8smetrics.NewDesc":             desc,
+}
+
+// wrapperPackages are the names of wrapper packages registered without
+// an import path. Any import with that last element is accepted.
+var wrapperPackages = make(map[string]bool)
+
+// acceptImport reports whether importing importPath makes a file worth
+// inspecting for constructor calls.
+func acceptImport(importPath string) bool {
+	if _, ok := clientPackage(importPath); ok {
+		return true
+	}
+	return wrapperPackages[importPath[strings.LastIndex(importPath, "/")+1:]]
+}
+
+// addImportPaths registers comma separated import paths of packages that
+// stand in for github.com/prometheus/client_golang/prometheus.
+func addImportPaths(spec string) {
+	for _, importPath := range strings.Split(spec, ",") {
+		clientPackages[strings.TrimSpace(importPath)] = "prometheus"
+	}
+}
+
+// addConstructors registers the wrapper constructors given as a comma
+// separated list of [importpath/]pkg.Func=kind entries.
+func addConstructors(spec string) error {
+	for _, entry := range strings.Split(spec, ",") {
+		eq := strings.Index(entry, "=")
+		if eq < 0 {
+			return fmt.Errorf("constructor %q: missing =kind", entry)
+		}
+		sel, kindName := strings.TrimSpace(entry[:eq]), strings.TrimSpace(entry[eq+1:])
+
+		kind, ok := parseKind(kindName)
+		if !ok {
+			return fmt.Errorf("constructor %q: unknown kind %q", sel, kindName)
+		}
+
+		slash := strings.LastIndex(sel, "/")
+		dot := strings.LastIndex(sel, ".")
+		if dot <= slash+1 || dot == len(sel)-1 {
+			return fmt.Errorf("constructor %q: expected pkg.Func", sel)
+		}
+		pkgPath, pkgName := sel[:dot], sel[slash+1:dot]
+
+		constructors[pkgName+"."+sel[dot+1:]] = kind
+		if slash >= 0 {
+			clientPackages[pkgPath] = pkgName
+		} else {
+			wrapperPackages[pkgName] = true
+		}
+	}
+	return nil
 }
 
-func inspect(fset *token.FileSet, node ast.Node, mr matcher, accum *byScore) error {
+func inspect(fset *token.FileSet, fi *fileInfo, node ast.Node, mr matcher, accum *byScore) error {
 	callExpr, ok := node.(*ast.CallExpr)
 	if !ok {
 		return nil
 	}
 
-	name := getCallExprLiteral(callExpr)
+	name := getCallExprLiteral(callExpr, fi)
+
+	n := len(*accum)
+	defer func() {
+		varName, funcName := enclosing(callExpr, fi)
+		field := fi.fields[callExpr]
+		endLine := fset.Position(callExpr.End()).Line
+		column := fset.Position(callExpr.Pos()).Column
+		for i := n; i < len(*accum); i++ {
+			(*accum)[i].endLine = endLine
+			(*accum)[i].column = column
+			(*accum)[i].varName, (*accum)[i].funcName = varName, funcName
+			(*accum)[i].declKind = declarationKind(callExpr, fi)
+			if (*accum)[i].val == "" || placeholder.MatchString((*accum)[i].val) {
+				(*accum)[i].dynamic = true
+				(*accum)[i].nameExpr = nameExpression(callExpr, fi)
+			}
+			(*accum)[i].structType, (*accum)[i].fieldName = field.typ, field.name
+			(*accum)[i].generated = fi.generated
+			(*accum)[i].test = fi.test
+		}
+	}()
+
+	if kind, ok := constMetrics[name]; ok {
+		if kind == untyped && len(callExpr.Args) > 1 {
+			if k, ok := valueTypes[getSelectorLiteral(callExpr.Args[1], fi)]; ok {
+				kind = k
+			}
+		}
+
+		opts := getConstMetricOpts(callExpr, fi)
+		hit, ok := mr.Match(opts, fset.Position(node.Pos()))
+		if ok {
+			hit.kind = kind
+			hit.opts = opts
+			hit.constMetric = true
+			// The buckets of a const histogram are the keys of the map
+			// of its counts, known at run time.
+			if kind == histogram && len(callExpr.Args) > 3 {
+				hit.bucketsExpr = types.ExprString(callExpr.Args[3])
+			}
+			*accum = append(*accum, hit)
+		}
+		return nil
+	}
+
+	if bc, ok := builtinCollectors[name]; ok {
+		inspectCollector(bc, callExpr, fset.Position(node.Pos()), fi, mr, accum)
+		if n < len(*accum) {
+			(*accum)[n].registrations = getRegistrations(name, callExpr, fset, fi)
+		}
+		return nil
+	}
+
+	if kind, ok := vmConstructors[name]; ok {
+		inspectVictoriaMetrics(kind, callExpr, fset.Position(node.Pos()), fi, mr, accum)
+		return nil
+	}
+
+	if family, ok := wrapperFamilies[name]; ok {
+		inspectWrapper(family, callExpr, fset.Position(node.Pos()), fi, mr, accum)
+		return nil
+	}
 
 	kind, ok := constructors[name]
 	if ok {
-		opts := getOpts(callExpr)
+		var opts promOpts
+		if kind == desc {
+			opts = getDescOpts(callExpr, fi)
+		} else {
+			opts = getOpts(callExpr, fi)
+		}
 
-		hit, ok := mr.Match(opts, fset.Position(node.Pos()))
+		// Registerers wrapped with WrapRegistererWithPrefix change the
+		// name that is scraped, so that name is the one matched.
+		regs := getRegistrations(name, callExpr, fset, fi)
+		wrap := effectiveWrapping(regs)
+		matchOpts := opts
+		if wrap.prefix != "" {
+			matchOpts = promOpts{"Name": wrap.prefix + qualifiedMetricName(opts), "Help": opts["Help"]}
+		}
+
+		hit, ok := mr.Match(matchOpts, fset.Position(node.Pos()))
 
 		if ok {
 			hit.kind = kind
+			hit.opts = opts
+			if wrap.prefix != "" {
+				hit.declaredName = qualifiedMetricName(opts)
+			}
+			if kind == desc {
+				if len(callExpr.Args) > 3 {
+					hit.constLabels = getConstLabels(callExpr.Args[3], fi)
+				}
+			} else {
+				hit.constLabels = getConstLabels(optsField(callExpr, "ConstLabels", fi), fi)
+			}
+			for k, v := range wrap.labels {
+				if hit.constLabels == nil {
+					hit.constLabels = make(map[string]string)
+				}
+				hit.constLabels[k] = v
+			}
+			hit.labels, hit.labelsExpr = getLabelNames(labelsArg(name, kind, callExpr), fi)
+			hit.registrations = regs
+			switch kind {
+			case histogram:
+				hit.buckets, hit.bucketsExpr = getBuckets(callExpr, fi)
+			case summary:
+				hit.objectives, hit.objectivesExpr = getObjectives(callExpr, fi)
+				hit.maxAge = getMaxAge(callExpr, fi)
+			}
 			*accum = append(*accum, hit)
 		}
 	}
 	return nil
 }
 
-func process(path string, mr matcher, accum *byScore) error {
-	fset := token.NewFileSet()
-	tree, err := parser.ParseFile(fset, path, nil, parser.ImportsOnly)
-	if err != nil {
-		return err
+// enclosing returns the variable a constructor call is assigned to and
+// the function it is called in. Outside of functions, the variable is
+// the one declared by the enclosing var spec.
+func enclosing(c *ast.CallExpr, fi *fileInfo) (varName, funcName string) {
+	if id, ok := fi.targets[c]; ok {
+		varName = id.Name
+	}
+	for _, decl := range fi.decls {
+		if c.Pos() < decl.Pos() || c.End() > decl.End() {
+			continue
+		}
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			funcName = d.Name.Name
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				vs, ok := spec.(*ast.ValueSpec)
+				if ok && varName == "" && len(vs.Names) == 1 && c.Pos() >= vs.Pos() && c.End() <= vs.End() {
+					varName = vs.Names[0].Name
+				}
+			}
+		}
+		break
+	}
+	return varName, funcName
+}
+
+// nameExpression returns the Go expressions the name of a metric is
+// built from when they cannot be evaluated, such as
+// Name: fmt.Sprintf("%s_ops_total", kind).
+func nameExpression(c *ast.CallExpr, fi *fileInfo) string {
+	if optsLiteral(c, fi) == nil {
+		if len(c.Args) == 0 {
+			return ""
+		}
+		return types.ExprString(c.Args[0])
+	}
+	var parts []string
+	for _, field := range []string{"Namespace", "Subsystem", "Name"} {
+		expr := optsField(c, field, fi)
+		if expr == nil {
+			continue
+		}
+		if _, ok := evalString(expr, fi); !ok {
+			parts = append(parts, field+": "+types.ExprString(expr))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// declarationKind classifies where a constructor call is: in a
+// package-level declaration, in an init function, in a function run by
+// sync.Once.Do, or in another function, which may run many times.
+func declarationKind(c *ast.CallExpr, fi *fileInfo) string {
+	for _, decl := range fi.decls {
+		if c.Pos() < decl.Pos() || c.End() > decl.End() {
+			continue
+		}
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			return "package-var"
+		}
+		if fd.Recv == nil && fd.Name.Name == "init" {
+			return "init"
+		}
+		if inOnce(c, fd) {
+			return "once"
+		}
+		name := fd.Name.Name
+		if fd.Recv != nil && len(fd.Recv.List) == 1 {
+			recv := fd.Recv.List[0].Type
+			if star, ok := recv.(*ast.StarExpr); ok {
+				recv = star.X
+			}
+			name = types.ExprString(recv) + "." + name
+		}
+		return "func " + name
 	}
+	return ""
+}
 
+// inOnce reports whether c is in a function literal passed to a Do
+// method, as with sync.Once.
+func inOnce(c *ast.CallExpr, fd *ast.FuncDecl) bool {
 	found := false
-	for _, ispec := range tree.Imports {
-		if unquote(ispec.Path.Value) == "github.com/prometheus/client_golang/prometheus" {
+	ast.Inspect(fd, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpr)
+		if !ok || found {
+			return !found
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || sel.Sel.Name != "Do" || len(call.Args) != 1 {
+			return true
+		}
+		if lit, ok := call.Args[0].(*ast.FuncLit); ok && c.Pos() >= lit.Pos() && c.End() <= lit.End() {
 			found = true
-			break
 		}
-	}
+		return !found
+	})
+	return found
+}
 
-	if !found {
-		return nil
+// isFlagSet reports whether a flag was passed on the command line, even
+// with its default value.
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
+
+// importsClientPackage reports whether the file imports a package whose
+// constructors are recognized.
+func importsClientPackage(tree *ast.File) bool {
+	for _, ispec := range tree.Imports {
+		if acceptImport(unquote(ispec.Path.Value)) {
+			return true
+		}
 	}
+	return false
+}
 
-	tree, err = parser.ParseFile(fset, path, nil, 0)
+// processDir inspects the Go files directly inside dir.
+func processDir(dir string, mr matcher, accum *byScore) error {
+	entries, err := os.ReadDir(dir)
 	if err != nil {
 		return err
 	}
 
-	ast.Inspect(tree, func(node ast.Node) bool {
-		err := inspect(fset, node, mr, accum)
+	var paths []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".go" || (isTestFile(name) && !*includeTestsFlag) {
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, name))
+	}
+	return process(paths, mr, accum)
+}
+
+// isTestFile reports whether a file holds tests.
+func isTestFile(path string) bool {
+	return strings.HasSuffix(path, "_test.go")
+}
+
+// process inspects the files of a directory. Files that import one of
+// the client packages are inspected; the others are still parsed so that
+// identifiers can be resolved across the files of a package.
+func process(paths []string, mr matcher, accum *byScore) error {
+	fset := token.NewFileSet()
+
+	accepted := make(map[string]bool)
+	for _, path := range paths {
+		tree, err := parser.ParseFile(fset, path, nil, parser.ImportsOnly)
 		if err != nil {
-			_, _ = fmt.Fprintf(os.Stderr, "error inspecting AST for %s: %v", path, err)
+			return err
 		}
-		return err == nil
-	})
+		accepted[path] = importsClientPackage(tree)
+	}
+
+	found := false
+	for _, ok := range accepted {
+		found = found || ok
+	}
+	if !found {
+		return nil
+	}
+
+	trees := make(map[string]*ast.File)
+	pkgs := make(map[string][]*ast.File)
+	for _, path := range paths {
+		tree, err := parser.ParseFile(fset, path, nil, parser.ParseComments|parser.SkipObjectResolution)
+		if err != nil {
+			return err
+		}
+		trees[path] = tree
+		pkgs[tree.Name.Name] = append(pkgs[tree.Name.Name], tree)
+	}
+
+	// The files of a directory may belong to a package and its external
+	// test package, whose identifiers are resolved apart.
+	pkgInfos := make(map[string]*pkgInfo)
+	for name, files := range pkgs {
+		pkg, info := checkPackage(fset, files)
+		pkgInfos[name] = newPkgInfo(pkg, info, files)
+	}
+
+	infos := make(map[string]*fileInfo)
+	for _, path := range paths {
+		tree := trees[path]
+		infos[path] = collectFileInfo(tree, pkgInfos[tree.Name.Name])
+		infos[path].test = isTestFile(path)
+	}
+
+	for _, path := range paths {
+		if !accepted[path] {
+			continue
+		}
+		start := len(*accum)
+		fi := infos[path]
+		ast.Inspect(trees[path], func(node ast.Node) bool {
+			err := inspect(fset, fi, node, mr, accum)
+			if err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "error inspecting AST for %s: %v", path, err)
+			}
+			return err == nil
+		})
+		for i := start; i < len(*accum); i++ {
+			(*accum)[i].pkg = trees[path].Name.Name
+		}
+	}
 	return nil
 }
 
-func main() {
-	if len(os.Args) > 2 {
-		fmt.Println(`
+const usage = `
 Usage:
-    promgrep                         (lists declarations of all metrics)
-    promgrep some:metric:name        (searches for declaration of some:metric:name`)
-		os.Exit(0)
+    promgrep [flags]                         (lists declarations of all metrics)
+    promgrep [flags] some:metric:name        (searches for declaration of some:metric:name)
+    promgrep [flags] -e name1 -e name2       (searches for declarations of any of the names)
+
+Flags:
+`
+
+var (
+	constructorsFlag = flag.String("constructors", "",
+		"comma-separated extra constructors, e.g. 'example.com/internal/metrics.NewRequestCounter=counter'")
+	nativeHistogramsFlag = flag.Bool("native-histograms", false,
+		"print the native histogram settings of histograms")
+	verboseFlag = flag.Bool("v", false,
+		"print everything known about each metric, such as its labels, buckets and registrations, in a block")
+	typedFlag = flag.Bool("typed", false,
+		"load and type check packages to resolve constants across packages (slower)")
+	importPathFlag = flag.String("import-path", "",
+		"comma-separated import paths of client_golang forks to accept in addition to the standard ones")
+	includeGeneratedFlag = flag.Bool("include-generated", false,
+		"list metrics declared in generated files")
+	includeTestsFlag = flag.Bool("include-tests", false,
+		"search _test.go files as well")
+	regexFlag = flag.Bool("regex", false,
+		"match the query as a regular expression against the metric names")
+	globFlag = flag.Bool("glob", false,
+		"match the query as a shell glob against the metric names, the default for queries with *, ? or [")
+	globSegmentsFlag = flag.Bool("glob-segments", false,
+		"make * in globs match within a single underscore-separated segment")
+	ignoreCaseFlag = flag.Bool("ignore-case", false,
+		"match the query regardless of case")
+	fuzzyFlag = flag.Bool("fuzzy", false,
+		"match the query approximately, tolerating typos and missing underscores")
+	tokensFlag = flag.Bool("tokens", false,
+		"match the words of the query as name tokens in any order; implied by a query with spaces")
+	helpContainsFlag = flag.String("help-contains", "",
+		"only list metrics whose help contains this text, regardless of case")
+	namespaceFlag = flag.String("namespace", "",
+		"only list metrics in this namespace")
+	namespacePrefixFlag = flag.Bool("namespace-prefix", false,
+		"match -namespace as a prefix of the namespace")
+	subsystemFlag = flag.String("subsystem", "",
+		"only list metrics in this subsystem; pass an empty value for metrics without one")
+	notNamespaceFlag = flag.String("not-namespace", "",
+		"do not list metrics in this namespace")
+	excludeFlag = flag.String("exclude", "",
+		"do not list metrics whose names match this regular expression")
+	minScoreFlag = flag.Int("min-score", 0,
+		"drop matches scoring below this")
+	strictFlag = flag.Bool("strict", false,
+		"drop weak matches, as -min-score=30 does")
+	exactFlag = flag.Bool("exact", false,
+		"only list metrics named exactly as the query")
+	fallbackFlag = flag.Bool("fallback", false,
+		"with -exact, list the scored matches when there is no exact match")
+	labelFlag       stringsFlag
+	constLabelFlag  stringsFlag
+	notLabelFlag    stringsFlag
+	kindFlag        kindsFlag
+	notKindFlag     kindsFlag
+	queryFlag       stringsFlag
+	rulesFlag       stringsFlag
+	pathIncludeFlag stringsFlag
+	pathExcludeFlag stringsFlag
+	bucketFlag      stringsFlag
+	formatFlag      = flag.String("format", "text",
+		"output format: text, json, ndjson, yaml, csv, tsv, exposition, markdown, vimgrep, sarif, prom-metadata, html, dot or tree")
+	groupByFlag = flag.String("group-by", "",
+		"print the metrics in a section per kind or package")
+	columnFlag = flag.Bool("column", false,
+		"print the column of the declarations after their line")
+	colorFlag = flag.String("color", "auto",
+		"color the output: always, never, or auto for terminals unless NO_COLOR is set")
+	templateFlag = flag.String("template", "",
+		"print each metric with this text/template, e.g. '{{.Path}}:{{.Line}}: {{.Name}}'")
+	helpWidthFlag = flag.Int("help-width", -1,
+		"truncate the help in the text output and markdown tables to this many characters, 0 for no limit, -1 for no limit in text and 80 in markdown")
+	dedupeFlag = flag.Bool("dedupe", false,
+		"print each name once, followed by the locations declaring it and whether their kinds or labels disagree")
+	linkTemplateFlag = flag.String("link-template", "",
+		"link the sources in the html output to this text/template, e.g. 'https://github.com/org/repo/blob/main/{{.Path}}#L{{.Line}}'")
+	absFlag = flag.Bool("abs", false,
+		"print absolute paths instead of paths relative to the current directory")
+	nullFlag = flag.Bool("null", false,
+		"end the lines of the text output and the paths of -l with a NUL byte instead of a newline, for xargs -0")
+	quietFlag = flag.Bool("q", false,
+		"print nothing, only exit with 0 when a metric is found, 1 when none is, and 2 on errors")
+	contextFlag = flag.Int("C", 0,
+		"print this many lines of source around each metric in the text output")
+	countFlag = flag.Bool("count", false,
+		"only print the number of metrics, or with -group-by, the number in each group")
+	filesWithMatchesFlag = flag.Bool("files-with-matches", false,
+		"only print the paths of the files declaring the metrics, once each")
+	sortFlag = flag.String("sort", "",
+		"sort the metrics by name, path, kind, line or score; default score for a query and name for a listing")
+	noSortFlag = flag.Bool("no-sort", false,
+		"list the metrics in the order they are found; with -format=ndjson, print them as they are found")
+	interactiveFlag = flag.Bool("interactive", false,
+		"pick a metric interactively, filtering the declarations as you type")
+	registryFlag = flag.String("registry", "",
+		"only list metrics registered with this registry variable, default for the default one, or unknown for unregistered ones")
+	varFlag = flag.String("var", "",
+		"only list metrics assigned to a Go variable or struct field whose name contains this")
+	queriesFlag = flag.String("queries", "",
+		"read newline-separated queries from this file, or - for stdin, and list the best matches of each")
+	atFlag = flag.String("at", "",
+		"list the metrics declared at file.go:line, or in the function around it")
+	docsFlag = flag.Bool("docs", false,
+		"print a Markdown catalogue of the metrics, by namespace and subsystem")
+)
+
+func init() {
+	flag.Var(&rulesFlag, "rules", "report the declarations of the metrics referenced in this rules file, or with a query, search its recording rules too; can be repeated")
+	flag.Var(&queryFlag, "e", "search for this name; repeat to search for any of several names")
+	flag.Var(&kindFlag, "kind", "only list metrics of these kinds, e.g. counter,histogram; can be repeated")
+	flag.Var(&notKindFlag, "not-kind", "do not list metrics of these kinds; can be repeated")
+	flag.Var(&labelFlag, "label", "only list metrics with this label; repeat to require several")
+	flag.Var(&constLabelFlag, "const-label", "only list metrics with this const label, as key=value or key; can be repeated")
+	flag.Var(&notLabelFlag, "not-label", "do not list metrics with this label; can be repeated")
+	flag.Var(&bucketFlag, "bucket", "only list histograms with this bucket boundary, or one satisfying a comparison such as >=30; can be repeated")
+	flag.Var(&pathIncludeFlag, "path-include", "only list metrics declared in files matching this glob or under directories matching it; can be repeated")
+	flag.Var(&pathExcludeFlag, "path-exclude", "do not list metrics declared in files matching this glob or under directories matching it; can be repeated")
+	flag.BoolVar(regexFlag, "E", false, "shorthand for -regex")
+	flag.BoolVar(ignoreCaseFlag, "i", false, "shorthand for -ignore-case")
+	flag.BoolVar(exactFlag, "x", false, "shorthand for -exact")
+	flag.BoolVar(interactiveFlag, "I", false, "shorthand for -interactive")
+	flag.BoolVar(verboseFlag, "verbose", false, "same as -v")
+	flag.BoolVar(nullFlag, "0", false, "shorthand for -null")
+	flag.BoolVar(countFlag, "c", false, "shorthand for -count")
+	flag.BoolVar(filesWithMatchesFlag, "l", false, "shorthand for -files-with-matches")
+	flag.StringVar(formatFlag, "o", "text", "shorthand for -format")
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	args := parseArgs()
+	if err := setColor(*colorFlag); err != nil {
+		fatal(err)
+	}
+	write, ok := formatters[*formatFlag]
+	if !ok {
+		fatalf("unknown output format %q, expected one of %s", *formatFlag, formatNames())
+	}
+	if _, ok := sortOrders[*sortFlag]; *sortFlag != "" && !ok {
+		fatalf("invalid --sort %q, expected name, path, kind, line or score", *sortFlag)
+	}
+	if _, ok := groupKeys[*groupByFlag]; *groupByFlag != "" && !ok {
+		fatalf("invalid --group-by %q, expected kind or package", *groupByFlag)
+	}
+	if *groupByFlag != "" && *formatFlag != "text" {
+		fatal("--group-by only applies to the text output")
+	}
+	if *dedupeFlag {
+		switch *formatFlag {
+		case "text":
+			write = writeDedupe
+		case "json":
+			write = writeDedupeJSON
+		default:
+			fatal("--dedupe only applies to the text and json outputs")
+		}
+	}
+	if *linkTemplateFlag != "" {
+		if *formatFlag != "html" {
+			fatal("--link-template only applies to the html output")
+		}
+		link, err := template.New("link").Parse(*linkTemplateFlag)
+		if err != nil {
+			fatalf("invalid link template: %v", err)
+		}
+		write = writeHTML(link)
+	}
+	if *contextFlag < 0 {
+		fatalf("invalid -C %d, expected a number of lines", *contextFlag)
+	}
+	if *templateFlag != "" {
+		tmpl, err := template.New("hit").Parse(*templateFlag)
+		if err != nil {
+			fatalf("invalid template: %v", err)
+		}
+		write = writeTemplate(tmpl)
+	}
+
+	// With -q, every mode runs as usual with its output discarded, so
+	// that the exit status is the same.
+	if *quietFlag {
+		devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		if err != nil {
+			fatal(err)
+		}
+		os.Stdout = devNull
+	}
+
+	if *importPathFlag != "" {
+		addImportPaths(*importPathFlag)
+	}
+	if *constructorsFlag != "" {
+		if err := addConstructors(*constructorsFlag); err != nil {
+			fatal(err)
+		}
+	}
+
+	if *atFlag != "" {
+		os.Exit(reportAt(*atFlag))
 	}
 
 	var mr matcher
 	var accum byScore
 
-	mr = &matchAny{}
-	if len(os.Args) == 2 {
-		mr = &matchName{name:os.Args[1]}
+	queries := append(queryFlag, args...)
+	var selectors map[string][]labelMatcher
+	if !*regexFlag {
+		var err error
+		if selectors, err = parseSelectors(queries); err != nil {
+			fatal(err)
+		}
+	}
+	switch len(queries) {
+	case 0:
+		mr = &matchAny{}
+	case 1:
+		mr = newMatcher(queries[0])
+	default:
+		me := &matchEither{}
+		for _, query := range queries {
+			me.queries = append(me.queries, query)
+			me.matchers = append(me.matchers, newMatcher(query))
+		}
+		mr = me
+	}
+	fs := flagFilters()
+	if len(selectors) > 0 {
+		fs = append(fs, selectorFilter(selectors))
 	}
 
-	err := filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	if *queriesFlag != "" {
+		os.Exit(reportQueries(*queriesFlag, fs))
+	}
+
+	if *docsFlag {
+		decls := fs.apply(declarations(mr))
+		if !*includeGeneratedFlag {
+			decls = skipGenerated(decls)
 		}
-		if info.IsDir() || filepath.Ext(path) != ".go" || strings.HasSuffix(path, "_test.go") {
-			return nil
+		os.Exit(writeDocs(decls))
+	}
+
+	// The picker scans once and filters the declarations in memory.
+	if *interactiveFlag {
+		decls := fs.apply(declarations(&matchAny{}))
+		if !*includeGeneratedFlag {
+			decls = skipGenerated(decls)
 		}
+		absPaths(decls)
+		os.Exit(pick(decls, os.Stdin))
+	}
+
+	// Without a query, the rules files are checked against all the
+	// declarations.
+	if len(rulesFlag) > 0 && len(queries) == 0 {
+		os.Exit(reportRules(rulesFlag, declarations(&matchAny{})))
+	}
+
+	if *formatFlag == "ndjson" && *noSortFlag && *templateFlag == "" {
+		os.Exit(streamNDJSON(mr, fs, queries))
+	}
 
-		return process(path, mr, &accum)
+	out := newResults(fs, queries)
+	accum = out.add(declarations(mr))
+	if len(rulesFlag) > 0 {
+		accum = append(accum, out.add(recordingRules(rulesFlag, mr, declarations(&matchAny{})))...)
+	}
+	accum = append(accum, out.end()...)
+
+	if !*noSortFlag {
+		order := *sortFlag
+		if order == "" && len(queries) == 0 && *helpContainsFlag == "" {
+			order = "name"
+		} else if order == "" {
+			order = "score"
+		}
+		sortHits(accum, order)
+	}
+	var err error
+	if key := groupKeys[*groupByFlag]; *countFlag {
+		writeCounts(accum, key)
+	} else if *filesWithMatchesFlag {
+		writeFiles(accum)
+	} else if key != nil {
+		err = writeGroups(accum, key, write)
+	} else {
+		err = write(accum)
+	}
+	if err != nil {
+		fatal(err)
+	}
+
+	// Like grep, exit with 1 when nothing is found.
+	if len(accum) == 0 {
+		os.Exit(1)
+	}
+}
+
+// declarations returns the metric declarations of the packages under
+// the current directory that match mr.
+func declarations(mr matcher) byScore {
+	var accum byScore
+	scan(mr, func(hits byScore) {
+		accum = append(accum, hits...)
 	})
+	return accum
+}
+
+// scan passes the metric declarations matching mr to emit, a package at
+// a time.
+func scan(mr matcher, emit func(byScore)) {
+	var err error
+	if *typedFlag {
+		err = processTyped(mr, func(hits byScore) {
+			emit(seriesHits(hits))
+		})
+	} else {
+		err = filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				return nil
+			}
+
+			var hits byScore
+			if err := processDir(path, mr, &hits); err != nil {
+				return err
+			}
+			emit(seriesHits(hits))
+			return nil
+		})
+	}
 
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
+}
 
-	sort.Sort(accum)
+// note prints a note to stderr, unless -q is given.
+func note(format string, args ...any) {
+	if !*quietFlag {
+		_, _ = fmt.Fprintf(os.Stderr, "note: "+format+"\n", args...)
+	}
+}
 
-	for _, hit := range accum {
-		if hit.score == -1 {
-			fmt.Printf("%s:%d    %s %s: %s\n", hit.path, hit.line, hit.val, hit.kind, hit.help)
-		} else {
-			fmt.Printf("%s:%d    %s %s score:%d\n", hit.path, hit.line, hit.val, hit.kind, hit.score)
-		}
+// fatal prints an error and exits with 2, so that errors are told apart
+// from finding nothing.
+func fatal(args ...any) {
+	log.Print(args...)
+	os.Exit(2)
+}
+
+// fatalf prints a formatted error and exits with 2.
+func fatalf(format string, args ...any) {
+	log.Printf(format, args...)
+	os.Exit(2)
+}
+
+// parseArgs parses the flags wherever they are among the arguments, as
+// in promgrep duration --not-namespace=test, and returns the others.
+func parseArgs() []string {
+	flag.Parse()
+	var args []string
+	for flag.NArg() > 0 {
+		rest := flag.Args()
+		args = append(args, rest[0])
+		_ = flag.CommandLine.Parse(rest[1:])
 	}
+	return args
 }
@@ -0,0 +1,1343 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// scanSource scans the Go files of files, by name, written to a
+// temporary directory, and returns the declarations matching mr. The
+// paths of the hits are relative to the directory.
+func scanSource(t *testing.T, files map[string]string, mr matcher) byScore {
+	t.Helper()
+	dir := t.TempDir()
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var hits byScore
+	if err := processDir(dir, mr, &hits); err != nil {
+		t.Fatal(err)
+	}
+	for i := range hits {
+		if rel, err := filepath.Rel(dir, hits[i].path); err == nil {
+			hits[i].path = rel
+		}
+	}
+	return hits
+}
+
+// scanOne scans a single file m.go with src.
+func scanOne(t *testing.T, src string) byScore {
+	t.Helper()
+	return scanSource(t, map[string]string{"m.go": src}, &matchAny{})
+}
+
+// names returns the names of the hits, in order.
+func names(hits byScore) []string {
+	var names []string
+	for _, hit := range hits {
+		names = append(names, hit.val)
+	}
+	return names
+}
+
+// captureStdout returns what f prints on the standard output.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	return capture(t, &os.Stdout, f)
+}
+
+// capture returns what f writes to a standard file, os.Stdout or
+// os.Stderr.
+func capture(t *testing.T, file **os.File, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := *file
+	*file = w
+	defer func() { *file = old }()
+
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- string(b)
+	}()
+	f()
+	_ = w.Close()
+	return <-out
+}
+
+// setFlag sets a flag variable for the duration of a test.
+func setFlag[T any](t *testing.T, p *T, v T) {
+	t.Helper()
+	old := *p
+	*p = v
+	t.Cleanup(func() { *p = old })
+}
+
+func TestSummaries(t *testing.T) {
+	hits := scanOne(t, `package m
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	a = prometheus.NewSummary(prometheus.SummaryOpts{Namespace: "src", Subsystem: "http", Name: "a_seconds", Help: "A."})
+	b = prometheus.NewSummaryVec(prometheus.SummaryOpts{Name: "b_seconds"}, []string{"code"})
+	c = promauto.NewSummary(prometheus.SummaryOpts{Name: "c_seconds"})
+	d = promauto.NewSummaryVec(prometheus.SummaryOpts{Name: "d_seconds"}, []string{"code"})
+)
+`)
+	want := []string{"src_http_a_seconds", "b_seconds", "c_seconds", "d_seconds"}
+	if got := names(hits); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for _, hit := range hits {
+		if hit.kind != summary || hit.kind.String() != "Summary" {
+			t.Errorf("%s is a %v, want a Summary", hit.val, hit.kind)
+		}
+	}
+	if hits[0].help != "A." {
+		t.Errorf("help %q, want the help of the SummaryOpts", hits[0].help)
+	}
+}
+
+func TestFuncConstructors(t *testing.T) {
+	src := `package m
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	a = prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: "queue_depth", Help: "Queued jobs."}, func() float64 { return 0 })
+	b = prometheus.NewCounterFunc(prometheus.CounterOpts{Name: "cache_hits_total"}, func() float64 { return 0 })
+	c = prometheus.NewUntypedFunc(prometheus.UntypedOpts{Name: "cache_size"}, func() float64 { return 0 })
+	d = promauto.NewGaugeFunc(prometheus.GaugeOpts{Name: "auto_depth"}, func() float64 { return 0 })
+)
+`
+	want := map[string]metricKind{"queue_depth": gauge, "cache_hits_total": counter, "cache_size": untyped, "auto_depth": gauge}
+	hits := scanOne(t, src)
+	if len(hits) != len(want) {
+		t.Fatalf("got %v, want %d metrics", names(hits), len(want))
+	}
+	for _, hit := range hits {
+		if kind, ok := want[hit.val]; !ok || hit.kind != kind {
+			t.Errorf("%s is a %v, want %v", hit.val, hit.kind, kind)
+		}
+	}
+	if untyped.String() != "Untyped" {
+		t.Errorf("untyped prints as %q", untyped.String())
+	}
+
+	hits = scanSource(t, map[string]string{"m.go": src}, &matchName{name: "queue_depth"})
+	if len(hits) != 1 || hits[0].line != 9 || hits[0].help != "Queued jobs." {
+		t.Errorf("queue_depth found %+v, want the GaugeFunc at line 9", hits)
+	}
+}
+
+func TestPromautoWith(t *testing.T) {
+	hits := scanOne(t, `package m
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	reg = prometheus.NewRegistry()
+	a   = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{Name: "requests_total"}, []string{"code"})
+	b   = promauto.With(nil).NewHistogram(prometheus.HistogramOpts{Name: "latency_seconds"})
+	c   = other.With(reg).NewGauge(prometheus.GaugeOpts{Name: "not_promauto"})
+)
+`)
+	want := []string{"requests_total", "latency_seconds"}
+	if got := names(hits); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if hits[0].kind != counter || hits[1].kind != histogram {
+		t.Errorf("got kinds %v and %v, want Counter and Histogram", hits[0].kind, hits[1].kind)
+	}
+}
+
+func TestQualifiedMetricName(t *testing.T) {
+	for _, tt := range []struct {
+		opts promOpts
+		want string
+	}{
+		{promOpts{"Name": "requests_total"}, "requests_total"},
+		{promOpts{"Namespace": "src", "Name": "requests_total"}, "src_requests_total"},
+		{promOpts{"Subsystem": "http", "Name": "requests_total"}, "http_requests_total"},
+		{promOpts{"Namespace": "src", "Subsystem": "http", "Name": "requests_total"}, "src_http_requests_total"},
+		{promOpts{"Namespace": "src", "Subsystem": "http"}, ""},
+	} {
+		if got := qualifiedMetricName(tt.opts); got != tt.want {
+			t.Errorf("qualifiedMetricName(%v) = %q, want %q", tt.opts, got, tt.want)
+		}
+	}
+}
+
+func TestNamespaceOnly(t *testing.T) {
+	hits := scanOne(t, `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var c = prometheus.NewCounter(prometheus.CounterOpts{Namespace: "src", Name: "requests_total"})
+`)
+	if len(hits) != 1 || hits[0].val != "src_requests_total" {
+		t.Fatalf("got %v, want [src_requests_total]", names(hits))
+	}
+	if exact := namedExactly(hits, []string{"src_requests_total"}); len(exact) != 1 {
+		t.Errorf("-x src_requests_total found %v", names(exact))
+	}
+}
+
+func TestPromautoFactories(t *testing.T) {
+	hits := scanOne(t, `package m
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+func newMetrics(reg, debugReg prometheus.Registerer) {
+	factory := promauto.With(reg)
+	debug := promauto.With(debugReg)
+	factory.NewCounter(prometheus.CounterOpts{Name: "requests_total"})
+	factory.NewHistogram(prometheus.HistogramOpts{Name: "request_duration_seconds"})
+	debug.NewGauge(prometheus.GaugeOpts{Name: "debug_inflight"})
+}
+
+func shadowed(factory notAFactory) {
+	factory.NewCounter(prometheus.CounterOpts{Name: "shadowed_total"})
+}
+`)
+	sortHits(hits, "line")
+	want := []string{"requests_total", "request_duration_seconds", "debug_inflight"}
+	if got := names(hits); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i, kind := range []metricKind{counter, histogram, gauge} {
+		if hits[i].kind != kind {
+			t.Errorf("%s is a %v, want a %v", hits[i].val, hits[i].kind, kind)
+		}
+		if len(hits[i].registrations) != 1 || hits[i].registrations[0].auto != "promauto" {
+			t.Errorf("%s has registrations %v, want promauto", hits[i].val, hits[i].registrations)
+		}
+	}
+}
+
+func TestNewDesc(t *testing.T) {
+	src := `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	a = prometheus.NewDesc("jobs_total", "Jobs run.", []string{"queue"}, nil)
+	b = prometheus.NewDesc(prometheus.BuildFQName("src", "", "jobs_inflight"), "Jobs running.", nil, nil)
+)
+`
+	hits := scanOne(t, src)
+	want := []string{"jobs_total", "src_jobs_inflight"}
+	if got := names(hits); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for _, hit := range hits {
+		if hit.kind != desc || hit.kind.String() != "Desc" {
+			t.Errorf("%s is a %v, want a Desc", hit.val, hit.kind)
+		}
+	}
+	if hits[1].help != "Jobs running." {
+		t.Errorf("help %q, want the second argument of NewDesc", hits[1].help)
+	}
+
+	hits = scanSource(t, map[string]string{"m.go": src}, &matchName{name: "src_jobs"})
+	if len(hits) != 1 || hits[0].val != "src_jobs_inflight" {
+		t.Errorf("src_jobs found %v, want the BuildFQName of src_jobs_inflight", names(hits))
+	}
+}
+
+func TestConstMetrics(t *testing.T) {
+	hits := scanOne(t, `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var jobsDesc = prometheus.NewDesc("jobs_total", "Jobs run.", nil, nil)
+
+type collector struct{ depth *prometheus.Desc }
+
+func (c collector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(jobsDesc, prometheus.CounterValue, 1)
+	ch <- prometheus.MustNewConstMetric(c.depth, prometheus.GaugeValue, 2)
+	ch <- prometheus.MustNewConstHistogram(prometheus.NewDesc("wait_seconds", "Wait.", nil, nil), 1, 1, nil)
+	ch <- prometheus.MustNewConstSummary(jobsDesc, 1, 1, nil)
+}
+`)
+	var got []string
+	for _, hit := range hits {
+		if hit.kind != desc {
+			got = append(got, hit.val+" "+hit.kind.String())
+		}
+	}
+	want := []string{"jobs_total Counter", "c.depth Gauge", "wait_seconds Histogram", "jobs_total Summary"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestAliasedImports(t *testing.T) {
+	hits := scanSource(t, map[string]string{
+		"a.go": `package m
+
+import (
+	prom "github.com/prometheus/client_golang/prometheus"
+	auto "github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	a = prom.NewCounterVec(prom.CounterOpts{Name: "a_total"}, []string{"code"})
+	b = auto.NewGauge(prom.GaugeOpts{Name: "b_inflight"})
+)
+`,
+		"b.go": `package m
+
+import p "github.com/prometheus/client_golang/prometheus"
+
+var c = p.NewHistogram(p.HistogramOpts{Name: "c_seconds"})
+`,
+		"c.go": `package m
+
+import prometheus "example.com/not/prometheus"
+
+var d = prometheus.NewCounter(prometheus.CounterOpts{Name: "d_total"})
+`,
+	}, &matchAny{})
+	var got []string
+	for _, hit := range hits {
+		got = append(got, hit.val+" "+hit.kind.String())
+	}
+	sort.Strings(got)
+	want := []string{"a_total Counter", "b_inflight Gauge", "c_seconds Histogram"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestDotImports(t *testing.T) {
+	hits := scanOne(t, `package m
+
+import . "github.com/prometheus/client_golang/prometheus"
+
+var (
+	a = NewCounterVec(CounterOpts{Name: "a_total"}, []string{"code"})
+	b = NewGauge(GaugeOpts{Name: "b_inflight"})
+	c = NewHistogram(HistogramOpts{Name: "c_seconds"})
+)
+
+func NewHistogram(opts HistogramOpts) Histogram { return nil }
+`)
+	want := []string{"a_total", "b_inflight"}
+	if got := names(hits); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if hits[0].kind != counter || hits[1].kind != gauge {
+		t.Errorf("got kinds %v and %v, want Counter and Gauge", hits[0].kind, hits[1].kind)
+	}
+}
+
+func TestGoKit(t *testing.T) {
+	hits := scanOne(t, `package m
+
+import (
+	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	a = kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{Namespace: "src", Subsystem: "http", Name: "a_total", Help: "A."}, []string{"code"})
+	b = kitprometheus.NewGaugeFrom(stdprometheus.GaugeOpts{Name: "b_inflight"}, nil)
+	c = kitprometheus.NewHistogramFrom(stdprometheus.HistogramOpts{Name: "c_seconds"}, nil)
+	d = kitprometheus.NewSummaryFrom(stdprometheus.SummaryOpts{Name: "d_seconds"}, nil)
+)
+`)
+	want := []string{"src_http_a_total", "b_inflight", "c_seconds", "d_seconds"}
+	if got := names(hits); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i, kind := range []metricKind{counter, gauge, histogram, summary} {
+		if hits[i].kind != kind {
+			t.Errorf("%s is a %v, want a %v", hits[i].val, hits[i].kind, kind)
+		}
+	}
+	if hits[0].help != "A." {
+		t.Errorf("help %q, want the help of the CounterOpts", hits[0].help)
+	}
+
+	hits = scanOne(t, `package m
+
+import "github.com/go-kit/kit/metrics/prometheus"
+
+var a = prometheus.NewCounterFrom(CounterOpts{Name: "a_total"}, nil)
+`)
+	if got := names(hits); len(got) != 1 || got[0] != "a_total" {
+		t.Errorf("got %v from a file importing only go-kit, want [a_total]", got)
+	}
+}
+
+func TestAddConstructors(t *testing.T) {
+	saved := make(map[string]metricKind)
+	for sel, kind := range constructors {
+		saved[sel] = kind
+	}
+	t.Cleanup(func() {
+		constructors = saved
+		delete(clientPackages, "example.com/internal/metrics")
+		delete(wrapperPackages, "stats")
+	})
+
+	for _, spec := range []string{"metrics.NewCounter", "metrics.NewCounter=meter", "NewCounter=counter", "metrics.=counter"} {
+		if err := addConstructors(spec); err == nil {
+			t.Errorf("addConstructors(%q) succeeded, want an error", spec)
+		}
+	}
+	if err := addConstructors("example.com/internal/metrics.NewRequestCounter=counter, stats.NewLatency=Histogram"); err != nil {
+		t.Fatal(err)
+	}
+
+	hits := scanSource(t, map[string]string{
+		"a.go": `package m
+
+import m "example.com/internal/metrics"
+
+var a = m.NewRequestCounter(m.Opts{Namespace: "src", Subsystem: "http", Name: "requests_total"})
+`,
+		"b.go": `package m
+
+import "example.com/internal/stats"
+
+var b = stats.NewLatency(stats.Opts{Name: "latency_seconds"})
+`,
+	}, &matchAny{})
+	var got []string
+	for _, hit := range hits {
+		got = append(got, hit.val+" "+hit.kind.String())
+	}
+	sort.Strings(got)
+	want := []string{"latency_seconds Histogram", "src_http_requests_total Counter"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestForkedImportPaths(t *testing.T) {
+	const mirror = "example.com/mirror/promclient"
+	addImportPaths(" " + mirror + " ")
+	t.Cleanup(func() { delete(clientPackages, mirror) })
+
+	hits := scanSource(t, map[string]string{
+		"fork.go": `package m
+
+import (
+	"github.com/ourorg/client_golang/prometheus"
+	auto "github.com/ourorg/client_golang/prometheus/promauto"
+)
+
+var (
+	a = prometheus.NewCounter(prometheus.CounterOpts{Name: "fork_total"})
+	b = auto.NewGauge(prometheus.GaugeOpts{Name: "fork_aliased_inflight"})
+)
+`,
+		"vendor.go": `package m
+
+import prom "example.com/vendor/github.com/prometheus/client_golang/prometheus"
+
+var c = prom.NewCounter(prom.CounterOpts{Name: "vendored_total"})
+`,
+		"mirror.go": `package m
+
+import "example.com/mirror/promclient"
+
+var d = promclient.NewHistogram(promclient.HistogramOpts{Name: "mirror_seconds"})
+`,
+	}, &matchAny{})
+	got := names(hits)
+	sort.Strings(got)
+	want := []string{"fork_aliased_inflight", "fork_total", "mirror_seconds", "vendored_total"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestPromautoOnly(t *testing.T) {
+	hits := scanSource(t, map[string]string{
+		"auto.go": `package m
+
+import "github.com/prometheus/client_golang/prometheus/promauto"
+
+var requests = promauto.NewCounterVec(requestsOpts, []string{"code"})
+`,
+		"opts.go": `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var requestsOpts = prometheus.CounterOpts{Name: "requests_total"}
+`,
+	}, &matchAny{})
+	if len(hits) != 1 || hits[0].val != "requests_total" || hits[0].kind != counter || hits[0].path != "auto.go" {
+		t.Fatalf("got %v, want the counter requests_total in auto.go", names(hits))
+	}
+	if strings.Join(hits[0].labels, " ") != "code" {
+		t.Errorf("labels = %v, want [code]", hits[0].labels)
+	}
+}
+
+func TestNativeHistograms(t *testing.T) {
+	hits := scanOne(t, `package m
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	a = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:                            "native_seconds",
+		NativeHistogramBucketFactor:     1.1,
+		NativeHistogramMaxBucketNumber:  100,
+		NativeHistogramMinResetDuration: time.Hour,
+	})
+	b = prometheus.NewHistogram(prometheus.HistogramOpts{Name: "classic_seconds", Buckets: prometheus.DefBuckets})
+)
+`)
+	if len(hits) != 2 {
+		t.Fatalf("got %v, want two histograms", names(hits))
+	}
+	want := "NativeHistogramBucketFactor=1.1 NativeHistogramMaxBucketNumber=100 NativeHistogramMinResetDuration=time.Hour"
+	if got := nativeHistogramSettings(hits[0].opts); got != want {
+		t.Errorf("%s settings %q, want %q", hits[0].val, got, want)
+	}
+	if got := nativeHistogramSettings(hits[1].opts); got != "" {
+		t.Errorf("%s settings %q, want none", hits[1].val, got)
+	}
+}
+
+func TestPackageLabels(t *testing.T) {
+	hits := scanSource(t, map[string]string{
+		"m.go": `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var commonLabels = []string{"repo", "op"}
+
+var (
+	a = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "a_total"}, commonLabels)
+	b = prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "b_seconds"}, commonLabels)
+	c = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "c_total"}, sharedLabels)
+	d = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "d_inflight"}, append(commonLabels, "code"))
+)
+`,
+		"labels.go": `package m
+
+var sharedLabels = []string{"shard"}
+`,
+	}, &matchAny{})
+	for i, want := range []struct {
+		labels []string
+		expr   string
+	}{
+		{[]string{"repo", "op"}, ""},
+		{[]string{"repo", "op"}, ""},
+		{[]string{"shard"}, ""},
+		{nil, `append(commonLabels, "code")`},
+	} {
+		if i >= len(hits) {
+			t.Fatalf("got %v, want 4 metrics", names(hits))
+		}
+		if strings.Join(hits[i].labels, ",") != strings.Join(want.labels, ",") || hits[i].labelsExpr != want.expr {
+			t.Errorf("%s has labels %v %q, want %v %q", hits[i].val, hits[i].labels, hits[i].labelsExpr, want.labels, want.expr)
+		}
+	}
+}
+
+func TestOptsVariables(t *testing.T) {
+	hits := scanOne(t, `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var latencyOpts = prometheus.HistogramOpts{Name: "latency_seconds", Buckets: []float64{1, 2}}
+
+func newMetrics() {
+	opts := prometheus.CounterOpts{Namespace: "src", Subsystem: "http", Name: "requests_total", Help: "Requests."}
+	prometheus.NewCounter(opts)
+	prometheus.NewHistogram(latencyOpts)
+
+	var gaugeOpts = prometheus.GaugeOpts{Name: "inflight", ConstLabels: prometheus.Labels{"zone": "a"}}
+	prometheus.NewGauge(gaugeOpts)
+}
+`)
+	want := []string{"src_http_requests_total", "latency_seconds", "inflight"}
+	if got := names(hits); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if hits[0].help != "Requests." {
+		t.Errorf("help %q, want the help of opts", hits[0].help)
+	}
+	if len(hits[1].buckets) != 2 {
+		t.Errorf("buckets %v, want the buckets of latencyOpts", hits[1].buckets)
+	}
+	if hits[2].constLabels["zone"] != "a" {
+		t.Errorf("const labels %v, want those of gaugeOpts", hits[2].constLabels)
+	}
+}
+
+func TestOptsHelpers(t *testing.T) {
+	hits := scanOne(t, `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+func counterOpts(name, help string) prometheus.CounterOpts {
+	return prometheus.CounterOpts{Namespace: "src", Subsystem: "ci", Name: name, Help: help}
+}
+
+func gaugeOpts(name string) prometheus.GaugeOpts {
+	opts := prometheus.GaugeOpts{Name: name}
+	return opts
+}
+
+var (
+	a = prometheus.NewCounter(counterOpts("builds_total", "Builds run."))
+	b = prometheus.NewCounter(counterOpts("failures_total", failuresHelp))
+	c = prometheus.NewGauge(gaugeOpts("queue_depth"))
+)
+`)
+	if len(hits) != 3 {
+		t.Fatalf("got %v, want three metrics", names(hits))
+	}
+	for i, want := range []struct{ name, help string }{
+		{"src_ci_builds_total", "Builds run."},
+		{"src_ci_failures_total", "<failuresHelp>"},
+		{"", ""},
+	} {
+		if hits[i].val != want.name || hits[i].help != want.help {
+			t.Errorf("got %q with help %q, want %q with help %q", hits[i].val, hits[i].help, want.name, want.help)
+		}
+	}
+}
+
+func TestOptsConversions(t *testing.T) {
+	hits := scanOne(t, `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+func newMetrics() {
+	prometheus.NewCounter(prometheus.CounterOpts(prometheus.Opts{Name: "inline_total", Help: "Inline."}))
+
+	o := prometheus.Opts{Namespace: "src", Name: "converted_total"}
+	prometheus.NewCounter(prometheus.CounterOpts(o))
+	prometheus.NewGauge(prometheus.GaugeOpts(o))
+}
+`)
+	want := []string{"inline_total", "src_converted_total", "src_converted_total"}
+	if got := names(hits); !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if hits[0].help != "Inline." {
+		t.Errorf("help = %q, want Inline.", hits[0].help)
+	}
+	if hits[1].kind != counter || hits[2].kind != gauge {
+		t.Errorf("kinds are %v and %v, want Counter and Gauge", hits[1].kind, hits[2].kind)
+	}
+}
+
+func TestStructFields(t *testing.T) {
+	hits := scanOne(t, `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+type metrics struct {
+	fetches prometheus.Counter
+	errors  prometheus.Counter
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		fetches: prometheus.NewCounter(prometheus.CounterOpts{Name: "fetches_total"}),
+	}
+}
+
+func (m *metrics) init() {
+	m.errors = prometheus.NewCounter(prometheus.CounterOpts{Name: "errors_total"})
+}
+`)
+	for i, want := range []struct{ name, structType, field string }{
+		{"fetches_total", "metrics", "fetches"},
+		{"errors_total", "metrics", "errors"},
+	} {
+		if i >= len(hits) {
+			t.Fatalf("got %v, want 2 metrics", names(hits))
+		}
+		if hits[i].val != want.name || hits[i].structType != want.structType || hits[i].fieldName != want.field {
+			t.Errorf("got %s in %s.%s, want %s in %s.%s", hits[i].val, hits[i].structType, hits[i].fieldName, want.name, want.structType, want.field)
+		}
+	}
+	if context := formatContext(hits[0].varName, hits[0].structType, hits[0].fieldName, hits[0].funcName); context != " (field metrics.fetches in newMetrics)" {
+		t.Errorf("the context is %q, want (field metrics.fetches in newMetrics)", context)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	hits := scanSource(t, map[string]string{
+		"m.go": `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+const subsystem = "http"
+
+var requests = prometheus.NewCounter(counterOpts("requests_total"))
+
+func newMetrics() {
+	subsystem := dynamicSubsystem()
+	prometheus.NewCounter(prometheus.CounterOpts{Subsystem: subsystem, Name: "errors_total"})
+}
+`,
+		"helpers.go": `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+func counterOpts(name string) prometheus.CounterOpts {
+	return prometheus.CounterOpts{Namespace: "src", Subsystem: subsystem, Name: name}
+}
+`,
+	}, &matchAny{})
+	want := []string{"src_http_requests_total", "<subsystem>_errors_total"}
+	if got := names(hits); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestEnclosing(t *testing.T) {
+	hits := scanOne(t, `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var requests = prometheus.NewCounter(prometheus.CounterOpts{Name: "requests_total"})
+
+var (
+	a, b = prometheus.NewGauge(prometheus.GaugeOpts{Name: "a"}), prometheus.NewGauge(prometheus.GaugeOpts{Name: "b"})
+)
+
+func newMetrics() {
+	fetchDuration := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "fetch_duration_seconds"})
+	prometheus.MustRegister(fetchDuration, prometheus.NewCounter(prometheus.CounterOpts{Name: "inline_total"}))
+}
+`)
+	want := map[string]string{
+		"requests_total":         " (var requests)",
+		"a":                      " (var a)",
+		"b":                      " (var b)",
+		"fetch_duration_seconds": " (var fetchDuration in newMetrics)",
+		"inline_total":           " (in newMetrics)",
+	}
+	if len(hits) != len(want) {
+		t.Fatalf("got %v, want %d metrics", names(hits), len(want))
+	}
+	for _, hit := range hits {
+		if got := formatContext(hit.varName, hit.structType, hit.fieldName, hit.funcName); got != want[hit.val] {
+			t.Errorf("%s has context %q, want %q", hit.val, got, want[hit.val])
+		}
+	}
+}
+
+func TestRawStrings(t *testing.T) {
+	hits := scanOne(t, "package m\n\nimport \"github.com/prometheus/client_golang/prometheus\"\n\n"+
+		"var c = prometheus.NewCounter(prometheus.CounterOpts{\n"+
+		"\tName: `requests_total`,\n"+
+		"\tHelp: `Requests served,\r\n\tby status.`,\n"+
+		"})\n")
+	if len(hits) != 1 || hits[0].val != "requests_total" {
+		t.Fatalf("got %v, want [requests_total]", names(hits))
+	}
+	if want := "Requests served,\n\tby status."; hits[0].help != want {
+		t.Errorf("help = %q, want %q", hits[0].help, want)
+	}
+	if got, want := singleLine(hits[0].help), "Requests served, by status."; got != want {
+		t.Errorf("singleLine() = %q, want %q", got, want)
+	}
+}
+
+func TestUnquote(t *testing.T) {
+	for _, tt := range []struct{ lit, want string }{
+		{`"requests with \"special\" handling"`, `requests with "special" handling`},
+		{`"first line\nsecond line"`, "first line\nsecond line"},
+		{`"a\tb"`, "a\tb"},
+		{`"caf\u00e9"`, "café"},
+		{"`raw \\n`", `raw \n`},
+		{"not_a_literal", "not_a_literal"},
+	} {
+		if got := unquote(tt.lit); got != tt.want {
+			t.Errorf("unquote(%s) = %q, want %q", tt.lit, got, tt.want)
+		}
+	}
+
+	hits := scanOne(t, `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var c = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "caf\u00e9_total",
+	Help: "Requests with \"special\"\thandling.",
+})
+`)
+	if len(hits) != 1 {
+		t.Fatalf("got %v, want café_total", names(hits))
+	}
+	if hits[0].val != "café_total" || hits[0].help != "Requests with \"special\"\thandling." {
+		t.Errorf("got %q with help %q", hits[0].val, hits[0].help)
+	}
+}
+
+func TestIncludeTests(t *testing.T) {
+	files := map[string]string{
+		"m.go": `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var jobs = prometheus.NewCounter(prometheus.CounterOpts{Name: "jobs_total"})
+`,
+		"m_test.go": `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var fixture = prometheus.NewCounter(prometheus.CounterOpts{Name: "fixture_total"})
+`,
+	}
+	if got := names(scanSource(t, files, &matchAny{})); !slices.Equal(got, []string{"jobs_total"}) {
+		t.Errorf("got %v, want [jobs_total]", got)
+	}
+
+	setFlag(t, includeTestsFlag, true)
+	hits := scanSource(t, files, &matchAny{})
+	sort.Sort(hits)
+	if got := names(hits); !slices.Equal(got, []string{"jobs_total", "fixture_total"}) {
+		t.Fatalf("--include-tests found %v, want [jobs_total fixture_total]", got)
+	}
+	if hits[0].test || !hits[1].test {
+		t.Errorf("test is %v for m.go and %v for m_test.go, want false and true", hits[0].test, hits[1].test)
+	}
+}
+
+func TestComponentBase(t *testing.T) {
+	hits := scanOne(t, `package m
+
+import "k8s.io/component-base/metrics"
+
+var (
+	reconciles = metrics.NewCounterVec(&metrics.CounterOpts{
+		Subsystem:         "operator",
+		Name:              "reconciles_total",
+		Help:              "Reconciles run.",
+		StabilityLevel:    metrics.STABLE,
+		DeprecatedVersion: "1.29.0",
+	}, []string{"result"})
+	queueDepth = metrics.NewGauge(&metrics.GaugeOpts{Name: "queue_depth"})
+	upDesc     = metrics.NewDesc("up", "Whether the target is up.", nil, nil, metrics.ALPHA, "")
+)
+`)
+	want := []string{"operator_reconciles_total", "queue_depth", "up"}
+	if got := names(hits); !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if hits[0].kind != counter || !slices.Equal(hits[0].labels, []string{"result"}) {
+		t.Errorf("got a %v with labels %v, want a Counter with labels [result]", hits[0].kind, hits[0].labels)
+	}
+	if hits[0].opts["StabilityLevel"] != "metrics.STABLE" || hits[0].opts["DeprecatedVersion"] != "1.29.0" {
+		t.Errorf("got stability %q and deprecated version %q", hits[0].opts["StabilityLevel"], hits[0].opts["DeprecatedVersion"])
+	}
+	if hits[2].kind != desc || hits[2].opts["StabilityLevel"] != "metrics.ALPHA" {
+		t.Errorf("got a %v with stability %q, want an ALPHA Desc", hits[2].kind, hits[2].opts["StabilityLevel"])
+	}
+}
+
+func TestDeclarationKind(t *testing.T) {
+	hits := scanOne(t, `package m
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var requests = prometheus.NewCounter(prometheus.CounterOpts{Name: "requests_total"})
+
+var (
+	once sync.Once
+	jobs prometheus.Gauge
+)
+
+func init() {
+	prometheus.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "up"}))
+}
+
+func setup() {
+	once.Do(func() {
+		jobs = prometheus.NewGauge(prometheus.GaugeOpts{Name: "jobs"})
+	})
+}
+
+func NewServer() {
+	prometheus.NewCounter(prometheus.CounterOpts{Name: "server_requests_total"})
+}
+
+type handler struct{}
+
+func (h *handler) ServeHTTP() {
+	prometheus.NewCounter(prometheus.CounterOpts{Name: "handled_total"})
+}
+`)
+	want := map[string]string{
+		"requests_total":        "package-var",
+		"up":                    "init",
+		"jobs":                  "once",
+		"server_requests_total": "func NewServer",
+		"handled_total":         "func handler.ServeHTTP",
+	}
+	if len(hits) != len(want) {
+		t.Fatalf("got %v, want %d metrics", names(hits), len(want))
+	}
+	for _, hit := range hits {
+		if hit.declKind != want[hit.val] {
+			t.Errorf("%s is declared in %q, want %q", hit.val, hit.declKind, want[hit.val])
+		}
+	}
+}
+
+func TestDynamicNames(t *testing.T) {
+	src := `package m
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func newMetrics(kind, name string) {
+	prometheus.NewCounter(prometheus.CounterOpts{Name: fmt.Sprintf("src_%s_ops_total", kind)})
+	prometheus.NewGauge(prometheus.GaugeOpts{Name: name})
+	prometheus.NewCounter(prometheus.CounterOpts{Name: "static_ops_total"})
+}
+`
+	hits := scanOne(t, src)
+	want := []struct {
+		name     string
+		dynamic  bool
+		nameExpr string
+	}{
+		{"src_<kind>_ops_total", true, `Name: fmt.Sprintf("src_%s_ops_total", kind)`},
+		{"<name>", true, "Name: name"},
+		{"static_ops_total", false, ""},
+	}
+	if len(hits) != len(want) {
+		t.Fatalf("got %v, want %d metrics", names(hits), len(want))
+	}
+	for i, w := range want {
+		hit := hits[i]
+		if hit.val != w.name || hit.dynamic != w.dynamic || hit.nameExpr != w.nameExpr {
+			t.Errorf("got %s dynamic:%v %q, want %s dynamic:%v %q", hit.val, hit.dynamic, hit.nameExpr, w.name, w.dynamic, w.nameExpr)
+		}
+	}
+
+	scored := scanSource(t, map[string]string{"m.go": src}, &matchName{name: "src_search_ops_total"})
+	scores := make(map[string]int)
+	for _, hit := range scored {
+		scores[hit.val] = hit.score
+	}
+	if s, ok := scores["src_<kind>_ops_total"]; !ok || s >= 100 {
+		t.Errorf("src_search_ops_total found %v, want src_<kind>_ops_total with a low score", scores)
+	}
+}
+
+func TestGlob(t *testing.T) {
+	src := `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	a = prometheus.NewCounter(prometheus.CounterOpts{Namespace: "src", Name: "search_errors_total"})
+	b = prometheus.NewCounter(prometheus.CounterOpts{Namespace: "src", Name: "repo_updater_errors_total"})
+	c = prometheus.NewCounter(prometheus.CounterOpts{Namespace: "src", Name: "search_requests_total"})
+	d = prometheus.NewGauge(prometheus.GaugeOpts{Name: "worker1_jobs"})
+	e = prometheus.NewGauge(prometheus.GaugeOpts{Name: "worker2_jobs"})
+	f = prometheus.NewGauge(prometheus.GaugeOpts{Name: "workerx_jobs"})
+)
+`
+	for _, tt := range []struct {
+		pattern    string
+		segments   bool
+		ignoreCase bool
+		want       []string
+	}{
+		{"src_*_errors_total", false, false, []string{"src_repo_updater_errors_total", "src_search_errors_total"}},
+		{"src_*_errors_total", true, false, []string{"src_search_errors_total"}},
+		{"worker?_jobs", false, false, []string{"worker1_jobs", "worker2_jobs", "workerx_jobs"}},
+		{"worker[0-9]_jobs", false, false, []string{"worker1_jobs", "worker2_jobs"}},
+		{"worker[^0-9]_jobs", false, false, []string{"workerx_jobs"}},
+		{"SRC_SEARCH_*", false, true, []string{"src_search_errors_total", "src_search_requests_total"}},
+		{"SRC_SEARCH_*", false, false, nil},
+	} {
+		mg := &matchGlob{pattern: tt.pattern, segments: tt.segments, ignoreCase: tt.ignoreCase}
+		hits := scanSource(t, map[string]string{"m.go": src}, mg)
+		got := names(hits)
+		sort.Strings(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s (segments %t, ignore case %t) matched %v, want %v", tt.pattern, tt.segments, tt.ignoreCase, got, tt.want)
+		}
+		for _, hit := range hits {
+			if hit.score != 100 {
+				t.Errorf("%s matched %s with score %d, want 100", tt.pattern, hit.val, hit.score)
+			}
+		}
+	}
+
+	for _, query := range []string{"src_*", "worker?_jobs", "worker[12]_jobs"} {
+		if _, ok := newMatcher(query).(*matchGlob); !ok {
+			t.Errorf("%s is not matched as a glob", query)
+		}
+	}
+	setFlag(t, globFlag, true)
+	if _, ok := newMatcher("src_search_errors_total").(*matchGlob); !ok {
+		t.Error("--glob does not match queries as globs")
+	}
+}
+
+func TestSeries(t *testing.T) {
+	files := map[string]string{
+		"summary.go": `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var s = prometheus.NewSummary(prometheus.SummaryOpts{Name: "latency_seconds"})
+`,
+		"histogram.go": `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var h = prometheus.NewHistogram(prometheus.HistogramOpts{Name: "latency_seconds"})
+`,
+		"counter.go": `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var c = prometheus.NewCounter(prometheus.CounterOpts{Name: "latency_seconds_count"})
+`,
+	}
+	for _, tt := range []struct {
+		query string
+		// want are the kind and series of the hits, by path.
+		want map[string]string
+	}{
+		{"latency_seconds", map[string]string{"histogram.go": "Histogram", "summary.go": "Summary"}},
+		{"latency_seconds_count", map[string]string{"counter.go": "Counter", "histogram.go": "Histogram _count", "summary.go": "Summary _count"}},
+		{"latency_seconds_sum", map[string]string{"histogram.go": "Histogram _sum", "summary.go": "Summary _sum"}},
+		{"latency_seconds_bucket", map[string]string{"histogram.go": "Histogram _bucket"}},
+		{"latency_seconds_bucket_le_0_5", map[string]string{"histogram.go": "Histogram _bucket_le_0_5"}},
+		{"latency_seconds_p99", map[string]string{"summary.go": "Summary _p99"}},
+		{"latency_seconds_quantile_99", map[string]string{"summary.go": "Summary _quantile_99"}},
+	} {
+		hits := seriesHits(scanSource(t, files, &matchName{name: tt.query, prefix: true, suffix: true}))
+		got := make(map[string]string)
+		for _, hit := range hits {
+			got[hit.path] = strings.TrimSpace(hit.kind.String() + " " + hit.series)
+		}
+		if !maps.Equal(got, tt.want) {
+			t.Errorf("%s found %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestRuleSegment(t *testing.T) {
+	src := `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	a = prometheus.NewCounter(prometheus.CounterOpts{Namespace: "src", Name: "requests_total"})
+	b = prometheus.NewCounter(prometheus.CounterOpts{Namespace: "src", Name: "requests_total_by_code"})
+)
+`
+	for _, tt := range []struct {
+		query string
+		want  []string
+	}{
+		{"job:src_requests_total:rate5m", []string{"src_requests_total", "src_requests_total_by_code"}},
+		{"^job:src_requests_total:rate5m$", []string{"src_requests_total"}},
+		{"job:SRC_Requests_Total:rate5m", []string{"src_requests_total", "src_requests_total_by_code"}},
+		{"^job:SRC_REQUESTS_TOTAL:rate5m$", []string{"src_requests_total"}},
+	} {
+		setFlag(t, ignoreCaseFlag, strings.ToLower(tt.query) != tt.query)
+		hits := scanSource(t, map[string]string{"m.go": src}, newMatcher(tt.query))
+		got := names(hits)
+		sort.Strings(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s found %v, want %v", tt.query, got, tt.want)
+		}
+		for _, hit := range hits {
+			if !hit.ruleQuery {
+				t.Errorf("%s matched %s, not as a recording rule", tt.query, hit.val)
+			}
+		}
+	}
+}
+
+func TestSeriesFallback(t *testing.T) {
+	hits := seriesHits(scanSource(t, map[string]string{"m.go": `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	g = prometheus.NewGauge(prometheus.GaugeOpts{Name: "src_jobs"})
+	h = prometheus.NewHistogram(prometheus.HistogramOpts{Name: "src_jobs"})
+)
+`}, &matchName{name: "src_jobs_count"}))
+	sort.Slice(hits, func(i, j int) bool { return hits[i].kind < hits[j].kind })
+	if len(hits) != 2 {
+		t.Fatalf("got %v, want the gauge and the histogram", names(hits))
+	}
+	if g := hits[0]; g.kind != gauge || g.series != "" || g.score != 58 {
+		t.Errorf("the gauge matched with series %q and score %d, want the name as written and 58", g.series, g.score)
+	}
+	if h := hits[1]; h.kind != histogram || h.series != "_count" || h.score != 100 {
+		t.Errorf("the histogram matched with series %q and score %d, want _count and 100", h.series, h.score)
+	}
+}
+
+func TestFoldCase(t *testing.T) {
+	for s, want := range map[string]string{
+		"Src_HTTP":     "src_http",
+		"ȺBC":          "Ⱥbc",
+		"K":            "K",
+		"A\xffB":       "a\xffb",
+		"Ünïcode_ÉTAT": "ünïcode_état",
+	} {
+		if got := foldCase(s); got != want || len(got) != len(s) {
+			t.Errorf("foldCase(%q) = %q, want %q", s, got, want)
+		}
+	}
+}
+
+func TestIgnoreCase(t *testing.T) {
+	src := `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	a = prometheus.NewCounter(prometheus.CounterOpts{Namespace: "src", Subsystem: "http", Name: "requests_total", Help: "Requests."})
+	b = prometheus.NewCounter(prometheus.CounterOpts{Name: "Kelvin_K_total"})
+)
+`
+	for _, tt := range []struct{ query, cased string }{
+		{"SRC_HTTP_Requests", "src_http_requests"},
+		{"kelvin_k", "Kelvin_K"},
+	} {
+		want := scanSource(t, map[string]string{"m.go": src}, &matchName{name: tt.cased})
+		got := scanSource(t, map[string]string{"m.go": src}, &matchName{name: tt.query, ignoreCase: true})
+		if len(want) != 1 || len(got) != 1 || got[0].val != want[0].val || got[0].score != want[0].score || got[0].help != want[0].help {
+			t.Errorf("-i %s found %v, want %v as %s does", tt.query, got, want, tt.cased)
+		}
+	}
+	if hits := scanSource(t, map[string]string{"m.go": src}, &matchName{name: "SRC_HTTP_Requests"}); len(hits) != 0 {
+		t.Errorf("SRC_HTTP_Requests found %v without -i", names(hits))
+	}
+}
+
+func TestIgnoreCaseOffsets(t *testing.T) {
+	hits := scanSource(t, map[string]string{"m.go": `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var c = prometheus.NewCounter(prometheus.CounterOpts{Namespace: "ȺK", Name: "Requests_total"})
+`}, &matchName{name: "REQUESTS", ignoreCase: true})
+	if len(hits) != 1 {
+		t.Fatalf("REQUESTS matched %v, want ȺK_Requests_total", names(hits))
+	}
+	hit := hits[0]
+	if m := hit.matched; len(m) != 2 || m[1] > len(hit.val) || hit.val[m[0]:m[1]] != "Requests" {
+		t.Errorf("matched %v of %s, want Requests", m, hit.val)
+	}
+	if got, want := emphasizeFragment("ȺK Requests", "requests"), "ȺK "+emphasize("Requests"); got != want {
+		t.Errorf("emphasizeFragment() = %q, want %q", got, want)
+	}
+}
+
+func TestAnchors(t *testing.T) {
+	src := `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	a = prometheus.NewCounter(prometheus.CounterOpts{Namespace: "src", Subsystem: "gitserver", Name: "fetch_total"})
+	b = prometheus.NewCounter(prometheus.CounterOpts{Namespace: "src", Subsystem: "frontend", Name: "requests_total"})
+	c = prometheus.NewHistogram(prometheus.HistogramOpts{Subsystem: "gitserver", Name: "src_gitserver_seconds"})
+)
+`
+	for _, tt := range []struct {
+		query      string
+		ignoreCase bool
+		want       map[string]int
+	}{
+		{"^src_gitserver_", false, map[string]int{"src_gitserver_fetch_total": 56}},
+		{"^SRC_GITSERVER_", true, map[string]int{"src_gitserver_fetch_total": 56}},
+		{"_total$", false, map[string]int{"src_gitserver_fetch_total": 24, "src_frontend_requests_total": 22}},
+		{"^src_gitserver_fetch_total$", false, map[string]int{"src_gitserver_fetch_total": 100}},
+		{"^fetch_total$", false, map[string]int{}},
+	} {
+		setFlag(t, ignoreCaseFlag, tt.ignoreCase)
+		got := make(map[string]int)
+		for _, hit := range scanSource(t, map[string]string{"m.go": src}, newMatcher(tt.query)) {
+			got[hit.val] = hit.score
+		}
+		if !maps.Equal(got, tt.want) {
+			t.Errorf("%s found %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestIsFlagSet(t *testing.T) {
+	old := flag.CommandLine
+	t.Cleanup(func() { flag.CommandLine = old })
+	for _, tt := range []struct {
+		args []string
+		want bool
+	}{
+		{nil, false},
+		{[]string{"-subsystem="}, true},
+		{[]string{"-subsystem=search"}, true},
+	} {
+		flag.CommandLine = flag.NewFlagSet("promgrep", flag.ContinueOnError)
+		flag.String("subsystem", "", "")
+		if err := flag.CommandLine.Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		if got := isFlagSet("subsystem"); got != tt.want {
+			t.Errorf("isFlagSet() = %t with %v, want %t", got, tt.args, tt.want)
+		}
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	oldFlags, oldArgs := flag.CommandLine, os.Args
+	t.Cleanup(func() { flag.CommandLine, os.Args = oldFlags, oldArgs })
+	flag.CommandLine = flag.NewFlagSet("promgrep", flag.ContinueOnError)
+	namespace := flag.String("not-namespace", "", "")
+	kind := flag.String("kind", "", "")
+	os.Args = []string{"promgrep", "--kind=counter", "duration", "--not-namespace=test", "latency"}
+
+	args := parseArgs()
+	if !slices.Equal(args, []string{"duration", "latency"}) || *namespace != "test" || *kind != "counter" {
+		t.Errorf("parsed %v with -not-namespace=%q -kind=%q, want [duration latency] with test and counter", args, *namespace, *kind)
+	}
+}
+
+func TestExactMatches(t *testing.T) {
+	src := `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	a = prometheus.NewCounter(prometheus.CounterOpts{Namespace: "src", Name: "requests_total"})
+	b = prometheus.NewCounter(prometheus.CounterOpts{Namespace: "src", Name: "requests_total_by_code"})
+)
+`
+	for _, tt := range []struct {
+		query                string
+		ignoreCase, fallback bool
+		want                 []string
+		note                 string
+	}{
+		{"src_requests_total", false, false, []string{"src_requests_total"}, ""},
+		{"SRC_Requests_Total", true, false, []string{"src_requests_total"}, ""},
+		{"src_requests", false, false, nil, "note: no metric is named exactly src_requests\n"},
+		{"src_requests", false, true, []string{"src_requests_total", "src_requests_total_by_code"}, "note: listing the closest matches instead\n"},
+	} {
+		setFlag(t, exactFlag, true)
+		setFlag(t, ignoreCaseFlag, tt.ignoreCase)
+		setFlag(t, fallbackFlag, tt.fallback)
+		hits := scanSource(t, map[string]string{"m.go": src}, newMatcher(tt.query))
+		var exact byScore
+		notes := capture(t, &os.Stderr, func() {
+			out := newResults(nil, []string{tt.query})
+			exact = append(out.add(hits), out.end()...)
+		})
+		got := names(exact)
+		sort.Strings(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("-x %s found %v, want %v", tt.query, got, tt.want)
+		}
+		if !strings.HasSuffix(notes, tt.note) || (tt.note == "") != (notes == "") {
+			t.Errorf("-x %s noted %q, want %q", tt.query, notes, tt.note)
+		}
+		if tt.note == "" && exact[0].score != 100 {
+			t.Errorf("-x %s found %s with score %d, want 100", tt.query, exact[0].val, exact[0].score)
+		}
+	}
+}
+
+// TestExitStatus runs main in a child process, which it is itself when
+// PROMGREP_ARGS is set, to check the exit statuses.
+func TestExitStatus(t *testing.T) {
+	if args := os.Getenv("PROMGREP_ARGS"); args != "" {
+		os.Args = append([]string{"promgrep"}, strings.Fields(args)...)
+		main()
+		os.Exit(0)
+	}
+
+	dir := t.TempDir()
+	src := `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var requests = prometheus.NewCounter(prometheus.CounterOpts{Name: "requests_total"})
+`
+	if err := os.WriteFile(filepath.Join(dir, "m.go"), []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		args  string
+		code  int
+		quiet bool
+	}{
+		{"requests", 0, false},
+		{"-q requests", 0, true},
+		{"-q nothing_like_this", 1, true},
+		{"-q -x requests", 1, true},
+		{"-q --sort=size requests", 2, false},
+	} {
+		t.Run(tt.args, func(t *testing.T) {
+			cmd := exec.Command(os.Args[0], "-test.run=^TestExitStatus$")
+			cmd.Dir = dir
+			cmd.Env = append(os.Environ(), "PROMGREP_ARGS="+tt.args)
+			out, _ := cmd.CombinedOutput()
+			if code := cmd.ProcessState.ExitCode(); code != tt.code {
+				t.Errorf("exit status %d, want %d; printed\n%s", code, tt.code, out)
+			}
+			if tt.quiet && len(out) > 0 {
+				t.Errorf("printed %q, want nothing", out)
+			}
+		})
+	}
+}
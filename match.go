@@ -0,0 +1,146 @@
+package main
+
+import (
+	"go/token"
+	"path"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// matchEither matches any of several queries, scoring a hit with the
+// query it matches best.
+type matchEither struct {
+	queries  []string
+	matchers []matcher
+}
+
+func (me *matchEither) Match(opts promOpts, pos token.Position) (matchResult, bool) {
+	var best matchResult
+	found := false
+	for i, m := range me.matchers {
+		hit, ok := m.Match(opts, pos)
+		if ok && (!found || hit.score > best.score) {
+			best, found = hit, true
+			best.query = me.queries[i]
+		}
+	}
+	return best, found
+}
+
+// lowerOpts returns a copy of opts lowercased with foldCase.
+func lowerOpts(opts promOpts) promOpts {
+	lower := make(promOpts, len(opts))
+	for k, v := range opts {
+		lower[k] = foldCase(v)
+	}
+	return lower
+}
+
+// foldCase lowercases s rune by rune, except for the runes whose lower
+// case is encoded in a different number of bytes, such as the Kelvin sign,
+// and for invalid bytes, so that offsets in the result are offsets in s.
+func foldCase(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if lower := unicode.ToLower(r); utf8.RuneLen(lower) == size {
+			b.WriteRune(lower)
+		} else {
+			b.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	return b.String()
+}
+
+// matchRegex matches the qualified metric names against a regular
+// expression. The score is the share of the name covered by the match.
+type matchRegex struct {
+	re *regexp.Regexp
+}
+
+func (mr *matchRegex) Match(opts promOpts, pos token.Position) (matchResult, bool) {
+	qmn := qualifiedMetricName(opts)
+	loc := mr.re.FindStringIndex(qmn)
+	if loc == nil {
+		return matchResult{}, false
+	}
+	score := 100
+	if qmn != "" {
+		score = (loc[1] - loc[0]) * 100 / len(qmn)
+	}
+	return matchResult{
+		score:   score,
+		path:    pos.Filename,
+		line:    pos.Line,
+		column:  pos.Column,
+		val:     qmn,
+		help:    opts["Help"],
+		matched: loc,
+	}, true
+}
+
+// matchGlob matches the qualified metric names against a shell glob as
+// path.Match does. With segments, * does not cross underscores.
+type matchGlob struct {
+	pattern    string
+	segments   bool
+	ignoreCase bool
+}
+
+func (mg *matchGlob) Match(opts promOpts, pos token.Position) (matchResult, bool) {
+	qmn := qualifiedMetricName(opts)
+	pattern, name := mg.pattern, qmn
+	if mg.ignoreCase {
+		pattern, name = strings.ToLower(pattern), strings.ToLower(name)
+	}
+	if mg.segments {
+		// path.Match does not let * cross a separator.
+		pattern = strings.Replace(pattern, "_", "/", -1)
+		name = strings.Replace(name, "_", "/", -1)
+	}
+	if ok, _ := path.Match(pattern, name); !ok {
+		return matchResult{}, false
+	}
+	return matchResult{
+		score:  100,
+		path:   pos.Filename,
+		line:   pos.Line,
+		column: pos.Column,
+		val:    qmn,
+		help:   opts["Help"],
+	}, true
+}
+
+// newMatcher returns the matcher for a query selected by the flags. It
+// exits if the query is not a valid glob or regular expression.
+func newMatcher(query string) matcher {
+	switch {
+	case *regexFlag:
+		expr := query
+		if *ignoreCaseFlag {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			fatalf("invalid regular expression %q: %v", query, err)
+		}
+		return &matchRegex{re: re}
+	case *globFlag || strings.ContainsAny(query, "*?["):
+		if _, err := path.Match(query, ""); err != nil {
+			fatalf("invalid glob %q: %v", query, err)
+		}
+		return &matchGlob{pattern: query, segments: *globSegmentsFlag, ignoreCase: *ignoreCaseFlag}
+	case *fuzzyFlag:
+		return &matchFuzzy{name: query}
+	case *tokensFlag || strings.Contains(strings.TrimSpace(query), " "):
+		return &matchTokens{tokens: splitTokens(query)}
+	}
+	// Metric names cannot contain ^ or $, so they are always anchors.
+	prefix, suffix := strings.HasPrefix(query, "^"), strings.HasSuffix(query, "$")
+	name := strings.TrimSuffix(strings.TrimPrefix(query, "^"), "$")
+	return &matchName{name: name, ignoreCase: *ignoreCaseFlag, prefix: prefix, suffix: suffix}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"go/token"
+	"regexp"
+	"testing"
+)
+
+func TestMatchRegex(t *testing.T) {
+	hits := scanSource(t, map[string]string{"m.go": `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	a = prometheus.NewHistogram(prometheus.HistogramOpts{Name: "src_gitserver_exec_duration_seconds"})
+	b = prometheus.NewHistogram(prometheus.HistogramOpts{Name: "src_repoupdater_sync_duration_seconds"})
+	c = prometheus.NewHistogram(prometheus.HistogramOpts{Name: "src_frontend_request_duration_seconds"})
+	d = prometheus.NewCounter(prometheus.CounterOpts{Name: "src_gitserver_exec_total"})
+)
+`}, &matchRegex{re: regexp.MustCompile(`^src_(gitserver|repoupdater)_.*_duration_seconds$`)})
+	scores := make(map[string]int)
+	for _, hit := range hits {
+		scores[hit.val] = hit.score
+	}
+	want := map[string]int{
+		"src_gitserver_exec_duration_seconds":   100,
+		"src_repoupdater_sync_duration_seconds": 100,
+	}
+	if len(scores) != len(want) {
+		t.Fatalf("got %v, want %v", scores, want)
+	}
+	for name, score := range want {
+		if scores[name] != score {
+			t.Errorf("%s has score %d, want %d", name, scores[name], score)
+		}
+	}
+
+	partial := scanSource(t, map[string]string{"m.go": `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var d = prometheus.NewCounter(prometheus.CounterOpts{Name: "src_gitserver_exec_total"})
+`}, &matchRegex{re: regexp.MustCompile(`git[a-z]+`)})
+	if len(partial) != 1 || partial[0].score != len("gitserver")*100/len("src_gitserver_exec_total") {
+		t.Errorf("git[a-z]+ found %v, want src_gitserver_exec_total scored by the share of the name matched", names(partial))
+	}
+}
+
+func TestMatchEither(t *testing.T) {
+	me := &matchEither{}
+	for _, query := range []string{"src_gitserver_fetch", "src_repoupdater_sync", "fetch"} {
+		me.queries = append(me.queries, query)
+		me.matchers = append(me.matchers, newMatcher(query))
+	}
+	hits := scanSource(t, map[string]string{"m.go": `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	a = prometheus.NewCounter(prometheus.CounterOpts{Name: "src_gitserver_fetch_total"})
+	b = prometheus.NewCounter(prometheus.CounterOpts{Name: "src_repoupdater_sync_total"})
+	c = prometheus.NewCounter(prometheus.CounterOpts{Name: "src_frontend_requests_total"})
+)
+`}, me)
+	want := map[string]string{
+		"src_gitserver_fetch_total":  "src_gitserver_fetch",
+		"src_repoupdater_sync_total": "src_repoupdater_sync",
+	}
+	if len(hits) != len(want) {
+		t.Fatalf("got %v, want %d metrics", names(hits), len(want))
+	}
+	for _, hit := range hits {
+		if hit.query != want[hit.val] {
+			t.Errorf("%s matched %q, want %q", hit.val, hit.query, want[hit.val])
+		}
+		if single, _ := newMatcher(hit.query).Match(promOpts{"Name": hit.val}, token.Position{}); hit.score != single.score {
+			t.Errorf("%s has score %d, want %d as with %s alone", hit.val, hit.score, single.score, hit.query)
+		}
+	}
+}
+
+func TestMatchColumn(t *testing.T) {
+	opts := promOpts{"Namespace": "src", "Name": "requests_total"}
+	pos := token.Position{Filename: "m.go", Line: 5, Column: 13}
+	for name, mr := range map[string]matcher{
+		"any":       &matchAny{},
+		"name":      &matchName{name: "requests"},
+		"anchored":  &matchName{name: "src_requests", prefix: true},
+		"namespace": &matchName{name: "src_http_requests_total"},
+		"regex":     &matchRegex{re: regexp.MustCompile(`req\w+s`)},
+		"glob":      &matchGlob{pattern: "src_*"},
+		"fuzzy":     &matchFuzzy{name: "requets_total"},
+		"tokens":    &matchTokens{tokens: splitTokens("total requests")},
+	} {
+		hit, ok := mr.Match(opts, pos)
+		if !ok {
+			t.Errorf("%s: src_requests_total does not match", name)
+			continue
+		}
+		if hit.line != 5 || hit.column != 13 {
+			t.Errorf("%s: matched at %d:%d, want 5:13", name, hit.line, hit.column)
+		}
+	}
+}
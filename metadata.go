@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+// metadataUnits are the base units inferred from the suffixes of the
+// names in the prom-metadata output.
+var metadataUnits = []string{"seconds", "bytes", "ratio", "meters", "volts", "amperes", "joules", "grams", "celsius"}
+
+// promMetadata is an entry of the Prometheus /api/v1/metadata response.
+type promMetadata struct {
+	Type string `json:"type"`
+	Help string `json:"help"`
+	Unit string `json:"unit"`
+}
+
+// writePromMetadata prints the hits in the shape of the response of the
+// Prometheus /api/v1/metadata endpoint, a list of metadata per name, so
+// that what the code declares can be diffed against what Prometheus has
+// ingested. Each metric family has a single entry, from its declaration
+// ranked first by declarationRank, or the first of these.
+func writePromMetadata(hits byScore) error {
+	families := make(map[string]matchResult)
+	for _, hit := range hits {
+		// Recording rules, collectors and unknown names are not scraped
+		// as such.
+		if hit.kind == recordingRule || hit.kind == collector || hit.dynamic || hit.val == "" {
+			continue
+		}
+		if family, ok := families[hit.val]; ok && declarationRank(family) <= declarationRank(hit) {
+			continue
+		}
+		families[hit.val] = hit
+	}
+
+	metadata := make(map[string][]promMetadata, len(families))
+	for name, hit := range families {
+		typ, ok := expositionTypes[hit.kind]
+		if !ok {
+			typ = "unknown"
+		}
+		metadata[name] = []promMetadata{{Type: typ, Help: hit.help, Unit: metadataUnit(name)}}
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(metadata)
+}
+
+// metadataUnit returns the unit a metric name ends with, before _total,
+// or "".
+func metadataUnit(name string) string {
+	name = strings.TrimSuffix(name, "_total")
+	for _, unit := range metadataUnits {
+		if strings.HasSuffix(name, "_"+unit) {
+			return unit
+		}
+	}
+	return ""
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"time"
+)
+
+// durationUnits are the time package constants used in duration
+// expressions such as 10*time.Minute.
+var durationUnits = map[string]time.Duration{
+	"time.Nanosecond":  time.Nanosecond,
+	"time.Microsecond": time.Microsecond,
+	"time.Millisecond": time.Millisecond,
+	"time.Second":      time.Second,
+	"time.Minute":      time.Minute,
+	"time.Hour":        time.Hour,
+}
+
+// getObjectives evaluates the Objectives map literal of a summary. When
+// the expression cannot be evaluated statically, its source text is
+// returned instead.
+func getObjectives(c *ast.CallExpr, fi *fileInfo) (map[float64]float64, string) {
+	expr := optsField(c, "Objectives", fi)
+	if expr == nil {
+		return nil, ""
+	}
+
+	cl, ok := expr.(*ast.CompositeLit)
+	if !ok {
+		return nil, types.ExprString(expr)
+	}
+	objectives := make(map[float64]float64, len(cl.Elts))
+	for _, el := range cl.Elts {
+		kv, ok := el.(*ast.KeyValueExpr)
+		if !ok {
+			return nil, types.ExprString(expr)
+		}
+		q, ok := constFloat(kv.Key)
+		if !ok {
+			return nil, types.ExprString(expr)
+		}
+		e, ok := constFloat(kv.Value)
+		if !ok {
+			return nil, types.ExprString(expr)
+		}
+		objectives[q] = e
+	}
+	return objectives, ""
+}
+
+// getMaxAge evaluates the MaxAge of a summary, falling back to its
+// source text.
+func getMaxAge(c *ast.CallExpr, fi *fileInfo) string {
+	expr := optsField(c, "MaxAge", fi)
+	if expr == nil {
+		return ""
+	}
+	if d, ok := constDuration(expr); ok {
+		return d.String()
+	}
+	return types.ExprString(expr)
+}
+
+// constDuration evaluates arithmetic on integer literals and time
+// package units, such as 10*time.Minute or time.Duration(90)*time.Second.
+func constDuration(expr ast.Expr) (time.Duration, bool) {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		if e.Kind != token.INT {
+			return 0, false
+		}
+		v, ok := constFloat(e)
+		return time.Duration(v), ok
+	case *ast.SelectorExpr:
+		d, ok := durationUnits[types.ExprString(e)]
+		return d, ok
+	case *ast.ParenExpr:
+		return constDuration(e.X)
+	case *ast.CallExpr:
+		if types.ExprString(e.Fun) != "time.Duration" || len(e.Args) != 1 {
+			return 0, false
+		}
+		return constDuration(e.Args[0])
+	case *ast.BinaryExpr:
+		x, ok := constDuration(e.X)
+		if !ok {
+			return 0, false
+		}
+		y, ok := constDuration(e.Y)
+		if !ok {
+			return 0, false
+		}
+		switch e.Op {
+		case token.MUL:
+			return x * y, true
+		case token.QUO:
+			if y == 0 {
+				return 0, false
+			}
+			return x / y, true
+		case token.ADD:
+			return x + y, true
+		case token.SUB:
+			return x - y, true
+		}
+	}
+	return 0, false
+}
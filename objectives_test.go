@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"go/parser"
+	"testing"
+	"time"
+)
+
+func TestObjectives(t *testing.T) {
+	hits := scanOne(t, `package m
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	a = prometheus.NewSummary(prometheus.SummaryOpts{
+		Name:       "a_seconds",
+		Objectives: map[float64]float64{0.5: 0.05, 0.99: 0.001},
+		MaxAge:     10 * time.Minute,
+		AgeBuckets: 3,
+	})
+	b = prometheus.NewSummary(prometheus.SummaryOpts{Name: "b_seconds", Objectives: defaultObjectives, MaxAge: maxAge})
+	c = prometheus.NewSummary(prometheus.SummaryOpts{Name: "c_seconds"})
+)
+`)
+	if len(hits) != 3 {
+		t.Fatalf("got %v, want three summaries", names(hits))
+	}
+	for i, want := range []struct{ objectives, maxAge string }{
+		{"map[0.5:0.05 0.99:0.001]", "10m0s"},
+		{"defaultObjectives", "maxAge"},
+		{"", ""},
+	} {
+		got := hits[i].objectivesExpr
+		if hits[i].objectives != nil {
+			got = fmt.Sprint(hits[i].objectives)
+		}
+		if got != want.objectives || hits[i].maxAge != want.maxAge {
+			t.Errorf("%s has objectives %q and maxAge %q, want %q and %q", hits[i].val, got, hits[i].maxAge, want.objectives, want.maxAge)
+		}
+	}
+	if hits[0].opts["AgeBuckets"] != "3" {
+		t.Errorf("AgeBuckets = %q, want 3", hits[0].opts["AgeBuckets"])
+	}
+}
+
+func TestConstDuration(t *testing.T) {
+	for src, want := range map[string]time.Duration{
+		"90":                            90,
+		"time.Minute":                   time.Minute,
+		"10 * time.Minute":              10 * time.Minute,
+		"(time.Hour + time.Minute) / 2": (time.Hour + time.Minute) / 2,
+		"time.Duration(90)*time.Second": 90 * time.Second,
+		"time.Hour - 1":                 time.Hour - 1,
+	} {
+		expr, err := parser.ParseExpr(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, ok := constDuration(expr); !ok || got != want {
+			t.Errorf("constDuration(%s) = %v, %v, want %v", src, got, ok, want)
+		}
+	}
+	for _, src := range []string{"1.5", "maxAge", "time.Minute / 0", "time.Duration(n) * time.Second", "-time.Minute"} {
+		expr, err := parser.ParseExpr(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, ok := constDuration(expr); ok {
+			t.Errorf("constDuration(%s) = %v, want it not evaluated", src, got)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"cmp"
+	"sort"
+)
+
+// sortOrders compare two hits for each value of --sort. The ties are
+// broken by name, path and line, so that the order is deterministic.
+var sortOrders = map[string]func(a, b matchResult) int{
+	"score": func(a, b matchResult) int {
+		return cmp.Compare(b.score, a.score)
+	},
+	"name": func(a, b matchResult) int {
+		return 0
+	},
+	"path": func(a, b matchResult) int {
+		if c := cmp.Compare(a.path, b.path); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.line, b.line)
+	},
+	"kind": func(a, b matchResult) int {
+		return cmp.Compare(a.kind.String(), b.kind.String())
+	},
+	"line": func(a, b matchResult) int {
+		return cmp.Compare(a.line, b.line)
+	},
+}
+
+// sortHits sorts the hits in an order of sortOrders.
+func sortHits(hits byScore, order string) {
+	compare := sortOrders[order]
+	sort.SliceStable(hits, func(i, j int) bool {
+		a, b := hits[i], hits[j]
+		if c := compare(a, b); c != 0 {
+			return c < 0
+		}
+		if a.val != b.val {
+			return a.val < b.val
+		}
+		if a.path != b.path {
+			return a.path < b.path
+		}
+		return a.line < b.line
+	})
+}
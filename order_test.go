@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSortHits(t *testing.T) {
+	hits := byScore{
+		{score: 50, path: "b.go", line: 3, val: "up", kind: gauge},
+		{score: 90, path: "a.go", line: 9, val: "requests_total", kind: counter},
+		{score: 50, path: "a.go", line: 2, val: "up", kind: gauge},
+		{score: 70, path: "b.go", line: 1, val: "errors_total", kind: counter},
+	}
+	for order, want := range map[string][]string{
+		"score": {"a.go:9 requests_total", "b.go:1 errors_total", "a.go:2 up", "b.go:3 up"},
+		"name":  {"b.go:1 errors_total", "a.go:9 requests_total", "a.go:2 up", "b.go:3 up"},
+		"path":  {"a.go:2 up", "a.go:9 requests_total", "b.go:1 errors_total", "b.go:3 up"},
+		"kind":  {"b.go:1 errors_total", "a.go:9 requests_total", "a.go:2 up", "b.go:3 up"},
+		"line":  {"b.go:1 errors_total", "a.go:2 up", "b.go:3 up", "a.go:9 requests_total"},
+	} {
+		sorted := slices.Clone(hits)
+		sortHits(sorted, order)
+		var got []string
+		for _, hit := range sorted {
+			got = append(got, fmt.Sprintf("%s:%d %s", hit.path, hit.line, hit.val))
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("--sort %s gave %v, want %v", order, got, want)
+		}
+	}
+}
+
+// TestDeterministicOrder checks that the hits print in the same order
+// whatever order they are found in, when their scores are equal, as in
+// listings, and when their names are too.
+func TestDeterministicOrder(t *testing.T) {
+	src := `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	a = prometheus.NewCounter(prometheus.CounterOpts{Name: "requests_total"})
+	b = prometheus.NewGauge(prometheus.GaugeOpts{Name: "requests_inflight"})
+	c = prometheus.NewCounter(prometheus.CounterOpts{Name: "errors_total"})
+)
+`
+	dir := t.TempDir()
+	for _, pkg := range []string{"z", "a", "m"} {
+		if err := os.Mkdir(filepath.Join(dir, pkg), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, pkg, "m.go"), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+
+	for _, tt := range []struct {
+		order string
+		mr    matcher
+	}{
+		{"name", &matchAny{}},
+		{"score", &matchName{name: "requests"}},
+		{"path", &matchAny{}},
+	} {
+		run := func(reverse bool) string {
+			hits := declarations(tt.mr)
+			if reverse {
+				slices.Reverse(hits)
+			}
+			sortHits(hits, tt.order)
+			return captureStdout(t, func() {
+				if err := writeText(hits); err != nil {
+					t.Fatal(err)
+				}
+			})
+		}
+		first, second := run(false), run(true)
+		if first == "" {
+			t.Fatalf("--sort %s printed nothing", tt.order)
+		}
+		if first != second {
+			t.Errorf("--sort %s printed\n%s\nthen\n%s", tt.order, first, second)
+		}
+	}
+}
@@ -0,0 +1,741 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// formatters write the sorted hits in the output formats selected by
+// --format.
+var formatters = map[string]func(hits byScore) error{
+	"text":          writeText,
+	"json":          writeJSON,
+	"ndjson":        writeNDJSON,
+	"csv":           writeCSV(','),
+	"tsv":           writeCSV('\t'),
+	"exposition":    writeExposition,
+	"markdown":      writeMarkdown,
+	"vimgrep":       writeVimgrep,
+	"sarif":         writeSARIF,
+	"yaml":          writeYAML,
+	"prom-metadata": writePromMetadata,
+	"html":          writeHTML(nil),
+	"dot":           writeDot,
+	"tree":          writeTree,
+}
+
+// formatNames returns the names of the output formats.
+func formatNames() string {
+	var names []string
+	for name := range formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// writeText prints a hit per line. Metrics whose names are only partly
+// known are listed last, so they do not hide among the others, under a
+// heading unless the lines end with NUL bytes.
+func writeText(hits byScore) error {
+	var dynamic byScore
+	for _, hit := range hits {
+		if hit.dynamic {
+			dynamic = append(dynamic, hit)
+			continue
+		}
+		printHit(hit)
+	}
+	if len(dynamic) > 0 && *nullFlag {
+		for _, hit := range dynamic {
+			printHit(hit)
+		}
+		return nil
+	}
+	if len(dynamic) > 0 {
+		if len(dynamic) < len(hits) {
+			fmt.Println()
+		}
+		fmt.Println("Dynamic metrics (names not known statically):")
+		for _, hit := range dynamic {
+			printHit(hit)
+		}
+	}
+	return nil
+}
+
+// printHit prints a hit on a line, or in a block with -v.
+func printHit(hit matchResult) {
+	if *verboseFlag {
+		printVerbose(hit)
+		return
+	}
+	fmt.Print(formatHit(hit))
+	endRecord()
+	if *contextFlag > 0 {
+		printSource(hit, *contextFlag)
+	}
+}
+
+// formatHit renders the line of a hit, the same with and without a
+// query: its location, name, kind and help, then its score when it
+// matched a query.
+func formatHit(hit matchResult) string {
+	var b strings.Builder
+	name := colorName(hit) + formatLabels(hit.constLabels, hit.labels, hit.labelsExpr, labelFlag)
+	if hit.declaredName != "" {
+		name += " (declared " + hit.declaredName + ")"
+	}
+	context := formatContext(hit.varName, hit.structType, hit.fieldName, hit.funcName)
+	if hit.test {
+		context += " (test)"
+	}
+	help := truncate(singleLine(hit.help), *helpWidthFlag)
+	if *helpContainsFlag != "" {
+		help = emphasizeFragment(help, *helpContainsFlag)
+	}
+	location := fmt.Sprintf("%s:%d", hit.path, hit.line)
+	if *columnFlag {
+		location += fmt.Sprintf(":%d", max(hit.column, 1))
+	}
+	location = colorize(dim, location)
+	kind := colorize(kindColors[hit.kind], hit.kind.String())
+	fmt.Fprintf(&b, "%s%s    %s %s:", location, context, name, kind)
+	if help != "" {
+		b.WriteString(" " + help)
+	}
+	if !hit.listed {
+		score := fmt.Sprintf("score:%d", hit.score)
+		if hit.score < strictMinScore {
+			score = colorize(gray, score)
+		}
+		fmt.Fprintf(&b, " %s", score)
+		if hit.query != "" {
+			fmt.Fprintf(&b, " query:%s", hit.query)
+		}
+	}
+	if hit.dynamic && hit.nameExpr != "" {
+		fmt.Fprintf(&b, " (%s)", hit.nameExpr)
+	}
+	if hit.series != "" {
+		fmt.Fprintf(&b, " (query is its %s series)", hit.series)
+	}
+	if hit.ruleQuery {
+		b.WriteString(" (query looks like a recording rule derived from it)")
+	}
+	if hit.derivedFrom != "" {
+		fmt.Fprintf(&b, " derived from %s", hit.derivedFrom)
+	}
+	if *nativeHistogramsFlag && hit.kind == histogram {
+		if settings := nativeHistogramSettings(hit.opts); settings != "" {
+			fmt.Fprintf(&b, " [%s]", settings)
+		}
+	}
+	if len(bucketFlag) > 0 {
+		buckets, def := histogramBuckets(hit)
+		switch {
+		case def:
+			fmt.Fprintf(&b, " buckets:%v(default)", buckets)
+		case buckets != nil:
+			fmt.Fprintf(&b, " buckets:%v", buckets)
+		case hit.bucketsExpr != "":
+			fmt.Fprintf(&b, " buckets:%s", hit.bucketsExpr)
+		}
+	}
+	return b.String()
+}
+
+// formatContext renders the variable, struct field and function of a
+// hit, such as (var fetchDuration in newMetrics) or
+// (field metrics.fetches in newMetrics).
+func formatContext(varName, structType, fieldName, funcName string) string {
+	var parts []string
+	if varName != "" {
+		parts = append(parts, "var "+varName)
+	}
+	if fieldName != "" {
+		field := fieldName
+		if structType != "" {
+			field = structType + "." + fieldName
+		}
+		parts = append(parts, "field "+field)
+	}
+	if funcName != "" {
+		parts = append(parts, "in "+funcName)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(parts, " ") + ")"
+}
+
+// singleLine collapses the newlines and runs of whitespace of a
+// multi-line help string for the one-line listing.
+func singleLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// endRecord ends the line of a hit, with a NUL byte instead of a newline
+// with -0.
+func endRecord() {
+	if *nullFlag {
+		fmt.Print("\x00")
+	} else {
+		fmt.Println()
+	}
+}
+
+// jsonHit is a hit in the JSON and YAML outputs. The field names are
+// stable, and in the same order in both. Data that is missing or not
+// known statically is null or omitted, while strings set to "" in the
+// code are kept empty.
+type jsonHit struct {
+	Path   string `json:"path" yaml:"path"`
+	Line   int    `json:"line" yaml:"line"`
+	Column int    `json:"column,omitempty" yaml:"column,omitempty"`
+	// Name is the qualified name that is scraped. Dynamic is set when
+	// parts of it are not known statically, and NameExpr holds the Go
+	// expressions they come from.
+	Name     string `json:"name" yaml:"name"`
+	Dynamic  bool   `json:"dynamic,omitempty" yaml:"dynamic,omitempty"`
+	NameExpr string `json:"nameExpr,omitempty" yaml:"nameExpr,omitempty"`
+	// Kind is Counter, Gauge, Histogram, Summary, Untyped, Desc,
+	// Collector or RecordingRule.
+	Kind string `json:"kind" yaml:"kind"`
+	// Help is null when the help is not set or not known statically.
+	Help *string `json:"help" yaml:"help"`
+	// Score is null when there is no query.
+	Score *int `json:"score" yaml:"score"`
+	// Query is the query the hit matched when there are several.
+	Query string `json:"query,omitempty" yaml:"query,omitempty"`
+	// Matched are the start and end byte offsets of the part of the
+	// name the query matched, when known.
+	Matched   []int  `json:"matched,omitempty" yaml:"matched,omitempty"`
+	Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	Subsystem string `json:"subsystem,omitempty" yaml:"subsystem,omitempty"`
+	// Labels are the variable label names, or LabelsExpr the source of
+	// the label names when they are not a literal.
+	Labels      []string          `json:"labels,omitempty" yaml:"labels,omitempty"`
+	LabelsExpr  string            `json:"labelsExpr,omitempty" yaml:"labelsExpr,omitempty"`
+	ConstLabels map[string]string `json:"constLabels,omitempty" yaml:"constLabels,omitempty"`
+	// Buckets are the bucket boundaries of a histogram, or BucketsExpr
+	// their source when they cannot be evaluated.
+	Buckets     []float64 `json:"buckets,omitempty" yaml:"buckets,omitempty"`
+	BucketsExpr string    `json:"bucketsExpr,omitempty" yaml:"bucketsExpr,omitempty"`
+	// Objectives are the quantile objectives of a summary by quantile,
+	// or ObjectivesExpr their source when they cannot be evaluated.
+	// MaxAge is the summary's MaxAge as a duration.
+	Objectives     map[string]float64 `json:"objectives,omitempty" yaml:"objectives,omitempty"`
+	ObjectivesExpr string             `json:"objectivesExpr,omitempty" yaml:"objectivesExpr,omitempty"`
+	MaxAge         string             `json:"maxAge,omitempty" yaml:"maxAge,omitempty"`
+	// Variable, Field and Function tell where the metric is held and
+	// created.
+	Variable string `json:"variable,omitempty" yaml:"variable,omitempty"`
+	Field    string `json:"field,omitempty" yaml:"field,omitempty"`
+	Function string `json:"function,omitempty" yaml:"function,omitempty"`
+	// DeclKind classifies where the metric is created, such as
+	// package-var, init, once or "func Name".
+	DeclKind string `json:"declKind,omitempty" yaml:"declKind,omitempty"`
+	// Registrations are the file:line of the registering calls, or the
+	// library registering the metric, such as promauto.
+	Registrations []string `json:"registrations,omitempty" yaml:"registrations,omitempty"`
+	Generated     bool     `json:"generated,omitempty" yaml:"generated,omitempty"`
+	Test          bool     `json:"test,omitempty" yaml:"test,omitempty"`
+}
+
+// newJSONHit converts a hit for the JSON output.
+func newJSONHit(hit matchResult) jsonHit {
+	jh := jsonHit{
+		Path:           hit.path,
+		Line:           hit.line,
+		Column:         hit.column,
+		Name:           hit.val,
+		Dynamic:        hit.dynamic,
+		NameExpr:       hit.nameExpr,
+		Kind:           hit.kind.String(),
+		Query:          hit.query,
+		Matched:        hit.matched,
+		Namespace:      hit.opts["Namespace"],
+		Subsystem:      hit.opts["Subsystem"],
+		Labels:         hit.labels,
+		LabelsExpr:     hit.labelsExpr,
+		ConstLabels:    hit.constLabels,
+		BucketsExpr:    hit.bucketsExpr,
+		ObjectivesExpr: hit.objectivesExpr,
+		MaxAge:         hit.maxAge,
+		Variable:       hit.varName,
+		Function:       hit.funcName,
+		DeclKind:       hit.declKind,
+		Generated:      hit.generated,
+		Test:           hit.test,
+	}
+	if _, ok := hit.opts["Help"]; ok || hit.help != "" {
+		help := hit.help
+		jh.Help = &help
+	}
+	if !hit.listed {
+		score := hit.score
+		jh.Score = &score
+	}
+	jh.Buckets, _ = histogramBuckets(hit)
+	if hit.objectives != nil {
+		jh.Objectives = make(map[string]float64, len(hit.objectives))
+		for q, e := range hit.objectives {
+			jh.Objectives[strconv.FormatFloat(q, 'g', -1, 64)] = e
+		}
+	}
+	if hit.fieldName != "" {
+		jh.Field = hit.structType + "." + hit.fieldName
+	}
+	for _, reg := range hit.registrations {
+		if reg.auto != "" {
+			jh.Registrations = append(jh.Registrations, reg.auto)
+		} else {
+			jh.Registrations = append(jh.Registrations, fmt.Sprintf("%s:%d", reg.path, reg.line))
+		}
+	}
+	return jh
+}
+
+// writeJSON prints the hits as a JSON array.
+func writeJSON(hits byScore) error {
+	jhs := make([]jsonHit, 0, len(hits))
+	for _, hit := range hits {
+		jhs = append(jhs, newJSONHit(hit))
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(jhs)
+}
+
+// writeYAML prints the hits as a YAML list. Multi-line help strings are
+// block scalars.
+func writeYAML(hits byScore) error {
+	jhs := make([]jsonHit, 0, len(hits))
+	for _, hit := range hits {
+		jhs = append(jhs, newJSONHit(hit))
+	}
+	enc := yaml.NewEncoder(os.Stdout)
+	enc.SetIndent(2)
+	if err := enc.Encode(jhs); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// writeNDJSON prints a hit per line as JSON.
+func writeNDJSON(hits byScore) error {
+	enc := json.NewEncoder(os.Stdout)
+	for _, hit := range hits {
+		if err := enc.Encode(newJSONHit(hit)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// csvColumns are the columns of the CSV and TSV outputs, named as the
+// fields of the JSON output.
+var csvColumns = []string{"path", "line", "name", "kind", "namespace", "subsystem", "help", "labels"}
+
+// writeCSV returns a formatter printing the hits as CSV with a header
+// row, separating the fields with comma.
+func writeCSV(comma rune) func(hits byScore) error {
+	return func(hits byScore) error {
+		w := csv.NewWriter(os.Stdout)
+		w.Comma = comma
+		if err := w.Write(csvColumns); err != nil {
+			return err
+		}
+		for _, hit := range hits {
+			jh := newJSONHit(hit)
+			var help string
+			if jh.Help != nil {
+				help = *jh.Help
+			}
+			labels := strings.Join(jh.Labels, ",")
+			if jh.LabelsExpr != "" {
+				labels = jh.LabelsExpr
+			}
+			row := []string{jh.Path, strconv.Itoa(jh.Line), jh.Name, jh.Kind, jh.Namespace, jh.Subsystem, help, labels}
+			if err := w.Write(row); err != nil {
+				return err
+			}
+		}
+		w.Flush()
+		return w.Error()
+	}
+}
+
+// expositionTypes are the types of the exposition format by kind. The
+// other kinds are untyped.
+var expositionTypes = map[metricKind]string{
+	counter:   "counter",
+	gauge:     "gauge",
+	histogram: "histogram",
+	summary:   "summary",
+}
+
+// expositionHelp escapes a help string as the exposition format does.
+var expositionHelp = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+// writeExposition prints the hits sorted by name in the shape of a
+// scrape, with # HELP and # TYPE lines and the locations declaring each
+// name in comments, so that the declared metrics can be diffed against
+// the output of /metrics.
+func writeExposition(hits byScore) error {
+	byName := make(map[string]byScore)
+	var names []string
+	for _, hit := range hits {
+		// Recording rules are not scraped, and unknown names cannot be
+		// compared.
+		if hit.kind == recordingRule || hit.val == "" {
+			continue
+		}
+		if byName[hit.val] == nil {
+			names = append(names, hit.val)
+		}
+		byName[hit.val] = append(byName[hit.val], hit)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		// The Desc of a metric declared as well does not tell its type.
+		first := byName[name][0]
+		for _, hit := range byName[name] {
+			if hit.kind != desc {
+				first = hit
+				break
+			}
+		}
+		typ, ok := expositionTypes[first.kind]
+		if !ok {
+			typ = "untyped"
+		}
+		if first.help != "" {
+			fmt.Printf("# HELP %s %s\n", name, expositionHelp.Replace(first.help))
+		}
+		fmt.Printf("# TYPE %s %s\n", name, typ)
+		printed := make(map[string]bool)
+		for _, hit := range byName[name] {
+			location := fmt.Sprintf("%s:%d", hit.path, hit.line)
+			if !printed[location] {
+				fmt.Printf("# %s\n", location)
+				printed[location] = true
+			}
+		}
+	}
+	return nil
+}
+
+// markdownHelpWidth is the width the help is truncated to in Markdown
+// tables without --help-width, as whole paragraphs make rows unreadable.
+const markdownHelpWidth = 80
+
+// writeMarkdown prints the hits as a Markdown table sorted by name, so
+// that it can be committed and diffed.
+func writeMarkdown(hits byScore) error {
+	helpWidth := *helpWidthFlag
+	if helpWidth < 0 {
+		helpWidth = markdownHelpWidth
+	}
+	sorted := append(byScore(nil), hits...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.val != b.val {
+			return a.val < b.val
+		}
+		if a.path != b.path {
+			return a.path < b.path
+		}
+		return a.line < b.line
+	})
+
+	fmt.Println("| Name | Type | Labels | Help | Source |")
+	fmt.Println("| --- | --- | --- | --- | --- |")
+	for _, hit := range sorted {
+		labels := "`" + strings.Join(hit.labels, "`, `") + "`"
+		if len(hit.labels) == 0 {
+			labels = ""
+		}
+		if hit.labelsExpr != "" {
+			labels = "`" + hit.labelsExpr + "`"
+		}
+		fmt.Printf("| `%s` | %s | %s | %s | %s:%d |\n", hit.val, strings.ToLower(hit.kind.String()), markdownCell(labels, 0),
+			markdownCell(singleLine(hit.help), helpWidth), hit.path, hit.line)
+	}
+	return nil
+}
+
+// markdownCell escapes the pipes of a table cell and truncates it to
+// width runes, unless width is 0 or less.
+func markdownCell(text string, width int) string {
+	return strings.ReplaceAll(truncate(text, width), "|", `\|`)
+}
+
+// truncate shortens text to width runes, ending it with an ellipsis. A
+// width of 0 or less means no limit.
+func truncate(text string, width int) string {
+	if runes := []rune(text); width > 0 && len(runes) > width {
+		text = strings.TrimSpace(string(runes[:width-1])) + "…"
+	}
+	return text
+}
+
+// templateHit is the data of a hit rendered with --template and
+// --link-template.
+type templateHit struct {
+	Path        string
+	Line        int
+	Name        string
+	Kind        string
+	Score       int
+	Query       string
+	Help        string
+	Namespace   string
+	Subsystem   string
+	Labels      []string
+	ConstLabels map[string]string
+	Variable    string
+	Function    string
+	Dynamic     bool
+}
+
+// newTemplateHit returns the data of a hit for templates.
+func newTemplateHit(hit matchResult) templateHit {
+	return templateHit{
+		Path:        hit.path,
+		Line:        hit.line,
+		Name:        hit.val,
+		Kind:        hit.kind.String(),
+		Score:       hit.score,
+		Query:       hit.query,
+		Help:        singleLine(hit.help),
+		Namespace:   hit.opts["Namespace"],
+		Subsystem:   hit.opts["Subsystem"],
+		Labels:      hit.labels,
+		ConstLabels: hit.constLabels,
+		Variable:    hit.varName,
+		Function:    hit.funcName,
+		Dynamic:     hit.dynamic,
+	}
+}
+
+// writeTemplate returns a formatter rendering each hit through tmpl,
+// followed by a newline.
+func writeTemplate(tmpl *template.Template) func(hits byScore) error {
+	return func(hits byScore) error {
+		for _, hit := range hits {
+			if err := tmpl.Execute(os.Stdout, newTemplateHit(hit)); err != nil {
+				return err
+			}
+			fmt.Println()
+		}
+		return nil
+	}
+}
+
+// writeVimgrep prints the hits as path:line:column: name Kind lines, as
+// :grep in Vim and problem matchers in editors expect them.
+func writeVimgrep(hits byScore) error {
+	for _, hit := range hits {
+		fmt.Printf("%s:%d:%d: %s %s\n", hit.path, hit.line, max(hit.column, 1), hit.val, hit.kind)
+	}
+	return nil
+}
+
+// writeFiles prints the path of each file declaring a hit once, in the
+// order of the hits.
+func writeFiles(hits byScore) {
+	seen := make(map[string]bool)
+	for _, hit := range hits {
+		if !seen[hit.path] {
+			seen[hit.path] = true
+			fmt.Print(hit.path)
+			endRecord()
+		}
+	}
+}
+
+// skipGenerated drops the hits in generated files. A note is printed for
+// the metrics that are only declared in generated files so they are not
+// silently lost.
+func skipGenerated(hits byScore) byScore {
+	var g generatedHits
+	kept := g.skip(hits)
+	g.note()
+	return kept
+}
+
+// generatedHits drops the hits in generated files as they are found, to
+// note at the end the metrics that were only declared in generated files.
+type generatedHits struct {
+	declared map[string]bool
+	skipped  byScore
+}
+
+// skip returns the hits not in generated files.
+func (g *generatedHits) skip(hits byScore) byScore {
+	if g.declared == nil {
+		g.declared = make(map[string]bool)
+	}
+	var kept byScore
+	for _, hit := range hits {
+		if hit.generated {
+			g.skipped = append(g.skipped, hit)
+			continue
+		}
+		g.declared[hit.val] = true
+		kept = append(kept, hit)
+	}
+	return kept
+}
+
+// note prints a note for each metric skipped so far that was not
+// declared elsewhere.
+func (g *generatedHits) note() {
+	for _, hit := range g.skipped {
+		if !g.declared[hit.val] {
+			note("%s is only declared in generated file %s:%d, use --include-generated to list it", hit.val, hit.path, hit.line)
+			g.declared[hit.val] = true
+		}
+	}
+	g.skipped = nil
+}
+
+// namedExactly returns the hits named exactly as one of the queries,
+// scored 100.
+func namedExactly(hits byScore, queries []string) byScore {
+	var exact byScore
+	for _, hit := range hits {
+		for _, query := range queries {
+			if hit.val == query || (*ignoreCaseFlag && strings.EqualFold(hit.val, query)) {
+				hit.score = 100
+				exact = append(exact, hit)
+				break
+			}
+		}
+	}
+	return exact
+}
+
+// absPaths makes the paths of the hits and of their registrations
+// absolute with --abs. The paths are relative to the current directory
+// otherwise.
+func absPaths(hits byScore) {
+	if !*absFlag {
+		return
+	}
+	abs := func(path string) string {
+		if p, err := filepath.Abs(path); err == nil {
+			return p
+		}
+		return path
+	}
+	for i := range hits {
+		hits[i].path = abs(hits[i].path)
+		regs := make([]registration, len(hits[i].registrations))
+		for j, reg := range hits[i].registrations {
+			reg.path = abs(reg.path)
+			regs[j] = reg
+		}
+		hits[i].registrations = regs
+	}
+}
+
+// results prepares the hits found for printing: it keeps the exact
+// matches with --exact, applies the filters, drops the hits in generated
+// files and scores the help with --help-contains. It takes the hits as
+// they are found, so that they can be printed as they come, and holds
+// back what is only known at the end: whether --exact falls back on the
+// scored matches, and which metrics are only declared in generated files.
+type results struct {
+	fs        filters
+	queries   []string
+	exact     bool    // an exact match was found
+	closest   byScore // the hits before an exact match is found, with --fallback
+	generated generatedHits
+}
+
+func newResults(fs filters, queries []string) *results {
+	return &results{fs: fs, queries: queries}
+}
+
+// add returns the hits to print among those found.
+func (r *results) add(hits byScore) byScore {
+	if *exactFlag && len(r.queries) > 0 {
+		exact := namedExactly(hits, r.queries)
+		if len(exact) == 0 {
+			if *fallbackFlag && !r.exact {
+				r.closest = append(r.closest, hits...)
+			}
+			return nil
+		}
+		r.exact, r.closest = true, nil
+		hits = exact
+	}
+	return r.prepare(hits)
+}
+
+// end returns the hits left to print once all are found and prints the
+// notes about the missing exact match and the generated files.
+func (r *results) end() byScore {
+	var hits byScore
+	if *exactFlag && len(r.queries) > 0 && !r.exact {
+		note("no metric is named exactly %s", strings.Join(r.queries, " or "))
+		if *fallbackFlag {
+			note("listing the closest matches instead")
+			hits = r.prepare(r.closest)
+		}
+	}
+	r.generated.note()
+	return hits
+}
+
+func (r *results) prepare(hits byScore) byScore {
+	hits = r.fs.apply(hits)
+	if !*includeGeneratedFlag {
+		hits = r.generated.skip(hits)
+	}
+	if *helpContainsFlag != "" {
+		scoreHelp(hits, *helpContainsFlag)
+	}
+	absPaths(hits)
+	return hits
+}
+
+// streamNDJSON prints the hits as JSON lines as the packages are
+// scanned, without sorting or holding them, except for the closest
+// matches held for --exact --fallback until no exact match is found. It
+// returns the exit status: 1 when nothing is found.
+func streamNDJSON(mr matcher, fs filters, queries []string) int {
+	out := newResults(fs, queries)
+	found := false
+	emit := func(hits byScore) {
+		if err := writeNDJSON(hits); err != nil {
+			fatal(err)
+		}
+		found = found || len(hits) > 0
+	}
+
+	scan(mr, func(hits byScore) {
+		emit(out.add(hits))
+	})
+	if len(rulesFlag) > 0 {
+		emit(out.add(recordingRules(rulesFlag, mr, declarations(&matchAny{}))))
+	}
+	emit(out.end())
+	if !found {
+		return 1
+	}
+	return 0
+}
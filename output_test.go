@@ -0,0 +1,610 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestSkipGenerated(t *testing.T) {
+	hits := scanSource(t, map[string]string{
+		"m.go": `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var jobs = prometheus.NewCounter(prometheus.CounterOpts{Name: "jobs_total"})
+`,
+		"m.pb.go": `// Code generated by protoc-gen-metrics. DO NOT EDIT.
+
+package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	jobsCopy = prometheus.NewCounter(prometheus.CounterOpts{Name: "jobs_total"})
+	gen      = prometheus.NewCounter(prometheus.CounterOpts{Name: "generated_jobs_total"})
+)
+`,
+	}, &matchAny{})
+	if len(hits) != 3 {
+		t.Fatalf("got %v, want the 3 metrics", names(hits))
+	}
+
+	var kept byScore
+	notes := capture(t, &os.Stderr, func() {
+		kept = skipGenerated(hits)
+	})
+	if got := names(kept); len(got) != 1 || got[0] != "jobs_total" || kept[0].path != "m.go" {
+		t.Errorf("kept %v, want jobs_total in m.go", got)
+	}
+	want := "note: generated_jobs_total is only declared in generated file m.pb.go:9, use --include-generated to list it\n"
+	if notes != want {
+		t.Errorf("notes\n%s\nwant\n%s", notes, want)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	hits := byScore{
+		{listed: true, path: "m.go", line: 5, val: "src_requests_total", kind: counter, help: "Requests.",
+			opts: promOpts{"Namespace": "src", "Name": "requests_total", "Help": "Requests."}, labels: []string{"code"}},
+		{score: 70, path: "m.go", line: 6, val: "up", kind: gauge, opts: promOpts{"Name": "up", "Help": ""}},
+		{score: 70, path: "m.go", line: 7, val: "src_jobs", kind: untyped, dynamic: true, nameExpr: "name",
+			opts: promOpts{"Namespace": "src"}},
+	}
+	out := captureStdout(t, func() {
+		if err := writeJSON(hits); err != nil {
+			t.Fatal(err)
+		}
+	})
+	var got []map[string]any
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("%v in %s", err, out)
+	}
+	want := []map[string]any{
+		{"path": "m.go", "line": 5.0, "name": "src_requests_total", "kind": "Counter", "help": "Requests.", "score": nil,
+			"namespace": "src", "labels": []any{"code"}},
+		{"path": "m.go", "line": 6.0, "name": "up", "kind": "Gauge", "help": "", "score": 70.0},
+		{"path": "m.go", "line": 7.0, "name": "src_jobs", "kind": "Untyped", "help": nil, "score": 70.0,
+			"dynamic": true, "nameExpr": "name", "namespace": "src"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%v\nwant\n%v", got, want)
+	}
+	if out := captureStdout(t, func() { _ = writeJSON(nil) }); out != "[]\n" {
+		t.Errorf("no hits printed %q, want []", out)
+	}
+}
+
+func TestWriteYAML(t *testing.T) {
+	hits := byScore{
+		{listed: true, path: "m.go", line: 5, val: "src_requests_total", kind: counter, help: "Requests,\nby code.",
+			opts: promOpts{"Namespace": "src", "Name": "requests_total"}, labels: []string{"code"}},
+		{score: 70, path: "m.go", line: 6, val: "up", kind: gauge},
+	}
+	out := captureStdout(t, func() {
+		if err := writeYAML(hits); err != nil {
+			t.Fatal(err)
+		}
+	})
+	want := `- path: m.go
+  line: 5
+  name: src_requests_total
+  kind: Counter
+  help: |-
+    Requests,
+    by code.
+  score: null
+  namespace: src
+  labels:
+    - code
+- path: m.go
+  line: 6
+  name: up
+  kind: Gauge
+  help: null
+  score: 70
+`
+	if out != want {
+		t.Errorf("printed\n%s\nwant\n%s", out, want)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	hits := byScore{
+		{path: "m.go", line: 5, val: "src_requests_total", kind: counter, help: "Requests, by code\nand method.",
+			opts: promOpts{"Namespace": "src", "Name": "requests_total"}, labels: []string{"code", "method"}},
+		{path: "m.go", line: 6, val: "up", kind: gauge, labelsExpr: "labelNames"},
+	}
+	for comma, want := range map[rune]string{
+		',': `path,line,name,kind,namespace,subsystem,help,labels
+m.go,5,src_requests_total,Counter,src,,"Requests, by code
+and method.","code,method"
+m.go,6,up,Gauge,,,,labelNames
+`,
+		'\t': "path\tline\tname\tkind\tnamespace\tsubsystem\thelp\tlabels\n" +
+			"m.go\t5\tsrc_requests_total\tCounter\tsrc\t\t\"Requests, by code\nand method.\"\tcode,method\n" +
+			"m.go\t6\tup\tGauge\t\t\t\tlabelNames\n",
+	} {
+		out := captureStdout(t, func() {
+			if err := writeCSV(comma)(hits); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if out != want {
+			t.Errorf("separated with %q, printed\n%s\nwant\n%s", comma, out, want)
+		}
+	}
+}
+
+func TestWriteExposition(t *testing.T) {
+	hits := byScore{
+		{path: "b.go", line: 3, val: "up", kind: gauge},
+		{path: "a.go", line: 5, val: "jobs_total", kind: desc, help: "Jobs run."},
+		{path: "a.go", line: 9, val: "jobs_total", kind: counter, help: "Jobs run,\nby queue."},
+		{path: "a.go", line: 9, val: "jobs_total", kind: counter, help: "Jobs run,\nby queue."},
+		{path: "c.go", line: 2, val: "info", kind: untyped},
+		{path: "rules.yml", line: 4, val: "job:jobs:rate5m", kind: recordingRule},
+		{path: "d.go", line: 7, kind: counter, dynamic: true},
+	}
+	out := captureStdout(t, func() {
+		if err := writeExposition(hits); err != nil {
+			t.Fatal(err)
+		}
+	})
+	want := `# TYPE info untyped
+# c.go:2
+# HELP jobs_total Jobs run,\nby queue.
+# TYPE jobs_total counter
+# a.go:5
+# a.go:9
+# TYPE up gauge
+# b.go:3
+`
+	if out != want {
+		t.Errorf("printed\n%s\nwant\n%s", out, want)
+	}
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	hits := byScore{
+		{path: "b.go", line: 3, val: "up", kind: gauge, help: "Whether the target | job is up."},
+		{path: "a.go", line: 5, val: "jobs_total", kind: counter, help: "Jobs run,\n\tby queue.", labels: []string{"queue", "code"}},
+		{path: "c.go", line: 2, val: "info", kind: untyped, labelsExpr: "infoLabels"},
+	}
+	want := `| Name | Type | Labels | Help | Source |
+| --- | --- | --- | --- | --- |
+| ` + "`info`" + ` | untyped | ` + "`infoLabels`" + ` |  | c.go:2 |
+| ` + "`jobs_total`" + ` | counter | ` + "`queue`, `code`" + ` | Jobs run, by queue. | a.go:5 |
+| ` + "`up`" + ` | gauge |  | Whether the target \| job is up. | b.go:3 |
+`
+	setFlag(t, helpWidthFlag, 0)
+	out := captureStdout(t, func() {
+		if err := writeMarkdown(hits); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if out != want {
+		t.Errorf("printed\n%s\nwant\n%s", out, want)
+	}
+
+	setFlag(t, helpWidthFlag, 10)
+	out = captureStdout(t, func() {
+		if err := writeMarkdown(hits); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if !strings.Contains(out, "| Jobs run,… |") || !strings.Contains(out, "| Whether t… |") {
+		t.Errorf("--help-width=10 printed\n%s", out)
+	}
+}
+
+func TestWriteTemplate(t *testing.T) {
+	hits := byScore{
+		{score: 80, path: "m.go", line: 5, val: "src_requests_total", kind: counter, help: "Requests\n\tserved.",
+			opts: promOpts{"Namespace": "src"}, labels: []string{"code", "method"}},
+		{score: 40, path: "m.go", line: 9, val: "up", kind: gauge},
+	}
+	tmpl := template.Must(template.New("hit").Parse(`{{.Path}}:{{.Line}}: {{.Name}} {{.Kind}} {{.Score}} {{.Labels}} {{.Namespace}} {{.Help}}`))
+	out := captureStdout(t, func() {
+		if err := writeTemplate(tmpl)(hits); err != nil {
+			t.Fatal(err)
+		}
+	})
+	want := "m.go:5: src_requests_total Counter 80 [code method] src Requests served.\nm.go:9: up Gauge 40 []  \n"
+	if out != want {
+		t.Errorf("printed %q, want %q", out, want)
+	}
+}
+
+func TestColumns(t *testing.T) {
+	hits := scanOne(t, `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	requests = prometheus.NewCounter(prometheus.CounterOpts{Name: "requests_total"})
+	up       = prometheus.NewGauge(
+		prometheus.GaugeOpts{Name: "up"},
+	)
+)
+`)
+	sort.Sort(hits)
+	out := captureStdout(t, func() {
+		if err := writeVimgrep(hits); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if want := "m.go:6:13: requests_total Counter\nm.go:7:13: up Gauge\n"; out != want {
+		t.Errorf("printed %q, want %q", out, want)
+	}
+
+	setFlag(t, columnFlag, true)
+	out = captureStdout(t, func() { printHit(hits[0]) })
+	if want := "m.go:6:13 (var requests)    requests_total Counter:\n"; out != want {
+		t.Errorf("--column printed %q, want %q", out, want)
+	}
+}
+
+func TestWriteFiles(t *testing.T) {
+	hits := byScore{
+		{path: "b.go", line: 3, val: "up"},
+		{path: "a b.go", line: 5, val: "jobs_total"},
+		{path: "b.go", line: 9, val: "errors_total"},
+	}
+	out := captureStdout(t, func() { writeFiles(hits) })
+	if want := "b.go\na b.go\n"; out != want {
+		t.Errorf("printed %q, want %q", out, want)
+	}
+}
+
+func TestNullRecords(t *testing.T) {
+	setFlag(t, nullFlag, true)
+	hits := byScore{
+		{listed: true, path: "a b.go", line: 5, val: "jobs_total", kind: counter, help: "Jobs run,\nby queue."},
+		{listed: true, path: "a b.go", line: 6, kind: gauge, dynamic: true, nameExpr: "name"},
+	}
+	out := captureStdout(t, func() {
+		if err := writeText(hits); err != nil {
+			t.Fatal(err)
+		}
+	})
+	records := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	if len(records) != 2 || strings.Contains(out, "\n") {
+		t.Errorf("printed %q, want 2 records without newlines", out)
+	}
+	if out := captureStdout(t, func() { writeFiles(hits) }); out != "a b.go\x00" {
+		t.Errorf("-l printed %q, want %q", out, "a b.go\x00")
+	}
+}
+
+func TestAbsPaths(t *testing.T) {
+	t.Chdir(t.TempDir())
+	// Resolve the symbolic links of the temporary directory as Getwd does.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	regs := []registration{{path: "cmd/main.go", line: 9}}
+	hits := byScore{{path: "m.go", line: 5, registrations: regs}}
+
+	absPaths(hits)
+	if hits[0].path != "m.go" {
+		t.Errorf("without --abs, the path is %s, want m.go", hits[0].path)
+	}
+
+	setFlag(t, absFlag, true)
+	absPaths(hits)
+	if want := filepath.Join(wd, "m.go"); hits[0].path != want {
+		t.Errorf("path %s, want %s", hits[0].path, want)
+	}
+	if want := filepath.Join(wd, "cmd", "main.go"); hits[0].registrations[0].path != want {
+		t.Errorf("registration %s, want %s", hits[0].registrations[0].path, want)
+	}
+	if regs[0].path != "cmd/main.go" {
+		t.Errorf("the registrations shared with other hits changed to %s", regs[0].path)
+	}
+}
+
+func TestJSONSummary(t *testing.T) {
+	hits := scanOne(t, `package m
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s = prometheus.NewSummary(prometheus.SummaryOpts{
+	Name:       "latency_seconds",
+	Objectives: map[float64]float64{0.5: 0.05, 0.99: 0.001},
+	MaxAge:     time.Minute,
+})
+`)
+	if len(hits) != 1 {
+		t.Fatalf("got %v, want [latency_seconds]", names(hits))
+	}
+	out := captureStdout(t, func() {
+		if err := writeJSON(hits); err != nil {
+			t.Fatal(err)
+		}
+	})
+	var got []map[string]any
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("%v in %s", err, out)
+	}
+	want := map[string]any{"0.5": 0.05, "0.99": 0.001}
+	if !reflect.DeepEqual(got[0]["objectives"], want) {
+		t.Errorf("objectives = %v, want %v", got[0]["objectives"], want)
+	}
+	if got[0]["maxAge"] != "1m0s" {
+		t.Errorf("maxAge = %v, want 1m0s", got[0]["maxAge"])
+	}
+	if got[0]["declKind"] != "package-var" {
+		t.Errorf("declKind = %v, want package-var", got[0]["declKind"])
+	}
+}
+
+func TestTextHelpWidth(t *testing.T) {
+	hit := matchResult{listed: true, path: "m.go", line: 5, val: "requests_total", kind: counter,
+		help: "Total number of\n\tHTTP requests served."}
+	for _, tt := range []struct {
+		width int
+		want  string
+	}{
+		{-1, "requests_total Counter: Total number of HTTP requests served.\n"},
+		{0, "requests_total Counter: Total number of HTTP requests served.\n"},
+		{16, "requests_total Counter: Total number of…\n"},
+	} {
+		setFlag(t, helpWidthFlag, tt.width)
+		out := captureStdout(t, func() { printHit(hit) })
+		if !strings.HasSuffix(out, tt.want) {
+			t.Errorf("--help-width=%d printed %q, want it to end with %q", tt.width, out, tt.want)
+		}
+	}
+}
+
+func TestMarkdownHelpWidth(t *testing.T) {
+	help := strings.Repeat("word ", 30)
+	hits := byScore{{val: "x_total", kind: counter, help: help, path: "m.go", line: 1}}
+	for _, tt := range []struct {
+		width int
+		want  string
+	}{
+		{-1, strings.TrimSpace(help[:markdownHelpWidth-1]) + "…"},
+		{0, strings.TrimSpace(help)},
+		{10, "word word…"},
+	} {
+		setFlag(t, helpWidthFlag, tt.width)
+		out := captureStdout(t, func() {
+			if err := writeMarkdown(hits); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if !strings.Contains(out, "| "+tt.want+" |") {
+			t.Errorf("--help-width=%d printed\n%s\nwant the help %q", tt.width, out, tt.want)
+		}
+	}
+}
+
+func TestFormatHit(t *testing.T) {
+	hit := matchResult{
+		listed:  true,
+		path:    "m.go",
+		line:    5,
+		val:     "requests_total",
+		kind:    counter,
+		help:    "Total number of\n\tHTTP requests served.",
+		varName: "requests",
+	}
+	scored := hit
+	scored.listed, scored.score = false, 70
+
+	for _, tt := range []struct {
+		name         string
+		hit          matchResult
+		helpContains string
+		helpWidth    int
+		color        bool
+		want         string
+	}{
+		{
+			name:      "listing",
+			hit:       hit,
+			helpWidth: -1,
+			want:      "m.go:5 (var requests)    requests_total Counter: Total number of HTTP requests served.",
+		},
+		{
+			name:      "query",
+			hit:       scored,
+			helpWidth: -1,
+			want:      "m.go:5 (var requests)    requests_total Counter: Total number of HTTP requests served. score:70",
+		},
+		{
+			name:      "no help",
+			hit:       matchResult{listed: true, path: "m.go", line: 5, val: "up", kind: gauge},
+			helpWidth: -1,
+			want:      "m.go:5    up Gauge:",
+		},
+		{
+			name:      "truncated",
+			hit:       hit,
+			helpWidth: 16,
+			want:      "m.go:5 (var requests)    requests_total Counter: Total number of…",
+		},
+		{
+			name:      "not truncated",
+			hit:       hit,
+			helpWidth: 0,
+			want:      "m.go:5 (var requests)    requests_total Counter: Total number of HTTP requests served.",
+		},
+		{
+			name:         "help contains",
+			hit:          hit,
+			helpContains: "http",
+			helpWidth:    -1,
+			color:        true,
+			want:         "Total number of \x1b[1mHTTP\x1b[0m requests served.",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, helpContainsFlag, tt.helpContains)
+			setFlag(t, helpWidthFlag, tt.helpWidth)
+			setFlag(t, &colorOutput, tt.color)
+			got := formatHit(tt.hit)
+			if tt.color {
+				if !strings.Contains(got, tt.want) {
+					t.Errorf("formatHit() = %q, want it to contain %q", got, tt.want)
+				}
+			} else if got != tt.want {
+				t.Errorf("formatHit() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromMetadata(t *testing.T) {
+	hits := scanSource(t, map[string]string{
+		"a.go": `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var jobsDesc = prometheus.NewDesc("jobs_total", "Jobs run by the collector.", nil, nil)
+
+type collector struct{}
+
+func (collector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(jobsDesc, prometheus.CounterValue, 1)
+}
+
+var latency = prometheus.NewHistogram(prometheus.HistogramOpts{Name: "latency_seconds", Help: "Latency."})
+`,
+		"b.go": `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	jobs     = prometheus.NewCounter(prometheus.CounterOpts{Name: "jobs_total", Help: "Jobs run."})
+	latency2 = prometheus.NewHistogram(prometheus.HistogramOpts{Name: "latency_seconds", Help: "Request latency."})
+	up       = prometheus.NewDesc("up", "Whether the target is up.", nil, nil)
+)
+`,
+	}, &matchAny{})
+	sortHits(hits, "path")
+	out := captureStdout(t, func() {
+		if err := writePromMetadata(hits); err != nil {
+			t.Fatal(err)
+		}
+	})
+	var got map[string][]promMetadata
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("%v in %s", err, out)
+	}
+	want := map[string][]promMetadata{
+		"jobs_total":      {{Type: "counter", Help: "Jobs run."}},
+		"latency_seconds": {{Type: "histogram", Help: "Latency.", Unit: "seconds"}},
+		"up":              {{Type: "unknown", Help: "Whether the target is up."}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// TestStreamNDJSON checks that streaming prints what the buffered output
+// prints, the notes included, for hits in generated files and for
+// --exact with and without --fallback.
+func TestStreamNDJSON(t *testing.T) {
+	dir := t.TempDir()
+	for path, src := range map[string]string{
+		"a/m.go": `package a
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var jobs = prometheus.NewCounter(prometheus.CounterOpts{Name: "jobs_total"})
+`,
+		"b/m.pb.go": `// Code generated by protoc-gen-metrics. DO NOT EDIT.
+
+package b
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	jobs = prometheus.NewCounter(prometheus.CounterOpts{Name: "jobs_total"})
+	gen  = prometheus.NewCounter(prometheus.CounterOpts{Name: "generated_jobs_total"})
+)
+`,
+	} {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+
+	for _, tt := range []struct {
+		name            string
+		query           string
+		exact, fallback bool
+		want, notes     []string
+	}{
+		{"generated", "jobs", false, false, []string{"jobs_total"}, []string{"generated_jobs_total is only declared in generated file b/m.pb.go:9"}},
+		{"exact", "jobs_total", true, false, []string{"jobs_total"}, nil},
+		{"no exact match", "jobs", true, false, nil, []string{"no metric is named exactly jobs"}},
+		{"fallback", "jobs", true, true, []string{"jobs_total"}, []string{"listing the closest matches instead", "generated_jobs_total is only declared"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, exactFlag, tt.exact)
+			setFlag(t, fallbackFlag, tt.fallback)
+			queries := []string{tt.query}
+			mr := newMatcher(tt.query)
+
+			var streamed string
+			code := -1
+			streamedNotes := capture(t, &os.Stderr, func() {
+				streamed = captureStdout(t, func() {
+					code = streamNDJSON(mr, nil, queries)
+				})
+			})
+			var buffered string
+			bufferedNotes := capture(t, &os.Stderr, func() {
+				buffered = captureStdout(t, func() {
+					out := newResults(nil, queries)
+					hits := append(out.add(declarations(mr)), out.end()...)
+					if err := writeNDJSON(hits); err != nil {
+						t.Fatal(err)
+					}
+				})
+			})
+			if streamed != buffered || streamedNotes != bufferedNotes {
+				t.Errorf("streamed\n%s%s\nbuffered\n%s%s", streamedNotes, streamed, bufferedNotes, buffered)
+			}
+
+			var got []string
+			for _, line := range strings.Split(strings.TrimSpace(streamed), "\n") {
+				var hit struct{ Name string }
+				if err := json.Unmarshal([]byte(line), &hit); err == nil {
+					got = append(got, hit.Name)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("printed %v, want %v", got, tt.want)
+			}
+			if wantCode := map[bool]int{true: 0, false: 1}[len(tt.want) > 0]; code != wantCode {
+				t.Errorf("exit status %d, want %d", code, wantCode)
+			}
+			for _, n := range tt.notes {
+				if !strings.Contains(streamedNotes, n) {
+					t.Errorf("notes\n%s\nwant %q", streamedNotes, n)
+				}
+			}
+		})
+	}
+}
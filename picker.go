@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// pickerShown is the number of hits the picker lists at once.
+const pickerShown = 20
+
+// pick lets the user filter the hits interactively, typing words that
+// must all appear, possibly with gaps, in the name, the help or the path
+// of a hit. Typing the number of a listed hit prints its location on
+// stdout, and e followed by the number opens it in $EDITOR. The lists
+// and prompts go to stderr so that the location can be piped. It returns
+// the exit status: 1 when nothing is picked.
+func pick(hits byScore, in io.Reader) int {
+	sortHits(hits, "name")
+	shown := pickerFilter(hits, "")
+	pickerList(shown, len(hits))
+
+	scanner := bufio.NewScanner(in)
+	for {
+		_, _ = fmt.Fprint(os.Stderr, "> ")
+		if !scanner.Scan() {
+			_, _ = fmt.Fprintln(os.Stderr)
+			return 1
+		}
+		line := strings.TrimSpace(scanner.Text())
+
+		edit := strings.HasPrefix(line, "e") && len(line) > 1
+		number := line
+		if edit {
+			number = strings.TrimSpace(line[1:])
+		}
+		if n, err := strconv.Atoi(number); err == nil {
+			if n < 1 || n > len(shown) || n > pickerShown {
+				_, _ = fmt.Fprintf(os.Stderr, "no hit %d\n", n)
+				continue
+			}
+			hit := shown[n-1]
+			if edit {
+				return pickerEdit(hit)
+			}
+			fmt.Printf("%s:%d\n", hit.path, hit.line)
+			return 0
+		}
+
+		shown = pickerFilter(hits, line)
+		pickerList(shown, len(hits))
+	}
+}
+
+// pickerFilter returns the hits matching all the words of text, best
+// first.
+func pickerFilter(hits byScore, text string) byScore {
+	words := strings.Fields(strings.ToLower(text))
+	var kept byScore
+	for _, hit := range hits {
+		haystack := strings.ToLower(hit.val + " " + singleLine(hit.help) + " " + hit.path)
+		total := 0
+		matched := true
+		for _, word := range words {
+			score, ok := subsequenceScore(word, haystack)
+			if !ok {
+				matched = false
+				break
+			}
+			total += score
+		}
+		if !matched {
+			continue
+		}
+		if len(words) > 0 {
+			hit.score = total / len(words)
+		}
+		kept = append(kept, hit)
+	}
+	sortHits(kept, "score")
+	return kept
+}
+
+// subsequenceScore reports whether the letters of word appear in order
+// in text. The score is 100 when they are contiguous, and decreases as
+// the shortest span holding them grows.
+func subsequenceScore(word, text string) (int, bool) {
+	if strings.Contains(text, word) {
+		return 100, true
+	}
+	best := -1
+	for start := strings.IndexByte(text, word[0]); start >= 0; {
+		i, j := 0, start
+		for ; j < len(text) && i < len(word); j++ {
+			if text[j] == word[i] {
+				i++
+			}
+		}
+		if i < len(word) {
+			break
+		}
+		if span := j - start; best < 0 || span < best {
+			best = span
+		}
+		next := strings.IndexByte(text[start+1:], word[0])
+		if next < 0 {
+			break
+		}
+		start += next + 1
+	}
+	if best < 0 {
+		return 0, false
+	}
+	return len(word) * 100 / best, true
+}
+
+// pickerList prints the first hits to stderr, numbered.
+func pickerList(hits byScore, total int) {
+	for i, hit := range hits {
+		if i == pickerShown {
+			break
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "%3d  %s:%d    %s %s: %s\n", i+1, hit.path, hit.line, hit.val, hit.kind, singleLine(hit.help))
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "%d/%d metrics; type words to filter, a number to print its location, e and a number to edit it\n", len(hits), total)
+}
+
+// pickerEdit opens the declaration of a hit in $EDITOR.
+func pickerEdit(hit matchResult) int {
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		_, _ = fmt.Fprintln(os.Stderr, "EDITOR is not set")
+		fmt.Printf("%s:%d\n", hit.path, hit.line)
+		return 0
+	}
+	cmd := exec.Command(editor, "+"+strconv.Itoa(hit.line), hit.path)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	return 0
+}
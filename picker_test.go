@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPick(t *testing.T) {
+	hits := byScore{
+		{val: "src_gitserver_fetch_duration_seconds", kind: histogram, help: "Fetch latency.", path: "gitserver/metrics.go", line: 12},
+		{val: "src_frontend_requests_total", kind: counter, help: "Requests served.", path: "frontend/metrics.go", line: 30},
+		{val: "src_gitserver_clone_total", kind: counter, path: "gitserver/clone.go", line: 7},
+	}
+	for _, tt := range []struct {
+		input, want string
+		status      int
+	}{
+		{"1\n", "frontend/metrics.go:30\n", 0},
+		{"gitserver\n2\n", "gitserver/metrics.go:12\n", 0},
+		{"gsrv fetch\n1\n", "gitserver/metrics.go:12\n", 0},
+		{"served\n3\n1\n", "frontend/metrics.go:30\n", 0},
+		{"nothing\n", "", 1},
+	} {
+		status := -1
+		var out string
+		capture(t, &os.Stderr, func() {
+			out = captureStdout(t, func() {
+				status = pick(append(byScore(nil), hits...), strings.NewReader(tt.input))
+			})
+		})
+		if out != tt.want || status != tt.status {
+			t.Errorf("typing %q printed %q and exited with %d, want %q and %d", tt.input, out, status, tt.want, tt.status)
+		}
+	}
+}
+
+func TestSubsequenceScore(t *testing.T) {
+	for _, tt := range []struct {
+		word, text string
+		score      int
+		ok         bool
+	}{
+		{"fetch", "src_gitserver_fetch_total", 100, true},
+		{"gsrv", "src_gitserver_fetch_total", 57, true},
+		{"fecth", "src_gitserver_fetch_total", 0, false},
+	} {
+		score, ok := subsequenceScore(tt.word, tt.text)
+		if score != tt.score || ok != tt.ok {
+			t.Errorf("subsequenceScore(%q, %q) = %d, %v, want %d, %v", tt.word, tt.text, score, ok, tt.score, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"go/token"
+	"io"
+	"os"
+	"strings"
+)
+
+// queriesBest is the number of matches listed for each query read with
+// --queries.
+const queriesBest = 5
+
+// matchEach matches the declarations against several queries at once,
+// recording the score of each query in the hits, so that the tree is
+// walked once for all of them.
+type matchEach struct {
+	matchers []matcher
+}
+
+func (me *matchEach) Match(opts promOpts, pos token.Position) (matchResult, bool) {
+	var best matchResult
+	found := false
+	scores := make([]int, len(me.matchers))
+	for i, m := range me.matchers {
+		scores[i] = -1
+		hit, ok := m.Match(opts, pos)
+		if !ok {
+			continue
+		}
+		scores[i] = hit.score
+		if !found || hit.score > best.score {
+			best, found = hit, true
+		}
+	}
+	best.queryScores = scores
+	return best, found
+}
+
+// readQueries reads newline-separated queries from a file, or from the
+// standard input for "-". Blank lines are skipped.
+func readQueries(source string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if source != "-" {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var queries []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if query := strings.TrimSpace(scanner.Text()); query != "" {
+			queries = append(queries, query)
+		}
+	}
+	return queries, scanner.Err()
+}
+
+// reportQueries prints the best matches of each query read from source,
+// in a section per query, followed by the queries without a match. It
+// returns the exit status: 1 when a query has no match.
+func reportQueries(source string, fs filters) int {
+	queries, err := readQueries(source)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	me := &matchEach{}
+	queryFilters := make([]filters, len(queries))
+	for i, query := range queries {
+		queryFilters[i] = fs
+		if isSelector(query) && !*regexFlag {
+			name, matchers, err := parseSelector(query)
+			if err != nil {
+				fatalf("invalid selector %q: %v", query, err)
+			}
+			query = name
+			queryFilters[i] = append(filters{selectorFilter(map[string][]labelMatcher{"": matchers})}, fs...)
+		}
+		me.matchers = append(me.matchers, newMatcher(query))
+	}
+	decls := declarations(me)
+
+	var missing []string
+	for i, query := range queries {
+		var hits byScore
+		for _, decl := range decls {
+			if decl.queryScores[i] >= 0 {
+				decl.score = decl.queryScores[i]
+				hits = append(hits, decl)
+			}
+		}
+		hits = queryFilters[i].apply(hits)
+		if !*includeGeneratedFlag {
+			hits = skipGenerated(hits)
+		}
+		sortHits(hits, "score")
+		absPaths(hits)
+		if len(hits) > queriesBest {
+			hits = hits[:queriesBest]
+		}
+
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s:\n", query)
+		if len(hits) == 0 {
+			fmt.Println("    no match")
+			missing = append(missing, query)
+		}
+		for _, hit := range hits {
+			printHit(hit)
+		}
+	}
+
+	if len(missing) == 0 {
+		return 0
+	}
+	fmt.Printf("\nNo match for %d of %d queries:\n", len(missing), len(queries))
+	for _, query := range missing {
+		fmt.Println("    " + query)
+	}
+	return 1
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReportQueries(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "m.go"), []byte(`package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	requests = prometheus.NewCounter(prometheus.CounterOpts{Namespace: "src", Name: "requests_total"})
+	errors   = prometheus.NewCounter(prometheus.CounterOpts{Namespace: "src", Name: "errors_total"})
+)
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	queries := filepath.Join(dir, "queries.txt")
+	if err := os.WriteFile(queries, []byte("src_requests_total\n\n  errors  \nsrc_missing_total\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+
+	status := -1
+	out := captureStdout(t, func() {
+		status = reportQueries(queries, nil)
+	})
+	want := `src_requests_total:
+m.go:6 (var requests)    src_requests_total Counter: score:95
+
+errors:
+m.go:7 (var errors)    src_errors_total Counter: score:38
+`
+	if !strings.HasPrefix(out, want) {
+		t.Errorf("printed\n%s\nwant it to start with\n%s", out, want)
+	}
+	if want := "src_missing_total:\n    no match\n\nNo match for 1 of 3 queries:\n    src_missing_total\n"; !strings.HasSuffix(out, want) {
+		t.Errorf("printed\n%s\nwant it to end with\n%s", out, want)
+	}
+	if status != 1 {
+		t.Errorf("exited with %d, want 1", status)
+	}
+
+	if status := reportQueries(filepath.Join(dir, "missing.txt"), nil); status != 2 {
+		t.Errorf("a missing queries file exited with %d, want 2", status)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// registration is a call registering a metric with a registry.
+type registration struct {
+	pos  token.Pos
+	path string
+	line int
+	// registry is "default" for the default registerer, or the source
+	// of the registerer expression.
+	registry string
+	// auto names the library registering the metric on creation, such
+	// as promauto.
+	auto string
+	// registerer is the registerer expression, nil for the default one.
+	registerer ast.Expr
+	// wrapping is what the registerer adds to the metric.
+	wrapping wrapping
+}
+
+// wrapping is what prometheus.WrapRegistererWithPrefix and
+// WrapRegistererWith add to the metrics registered through a registerer.
+type wrapping struct {
+	prefix string
+	labels map[string]string
+}
+
+// recordRegistration records the metrics registered by a
+// prometheus.MustRegister/Register or registry.MustRegister/Register
+// call.
+func recordRegistration(c *ast.CallExpr, fi *fileInfo) {
+	sel, ok := c.Fun.(*ast.SelectorExpr)
+	if !ok || (sel.Sel.Name != "MustRegister" && sel.Sel.Name != "Register") {
+		return
+	}
+
+	registry, registerer := types.ExprString(sel.X), sel.X
+	switch getCallExprLiteral(c, fi) {
+	case "prometheus.MustRegister", "prometheus.Register":
+		registry, registerer = "default", nil
+	}
+
+	for _, arg := range c.Args {
+		var key interface{}
+		switch a := arg.(type) {
+		case *ast.Ident:
+			obj := fi.object(a)
+			if obj == nil {
+				continue
+			}
+			key = obj
+		case *ast.CallExpr:
+			key = a
+		default:
+			continue
+		}
+		fi.registrations[key] = append(fi.registrations[key], registration{pos: c.Pos(), registry: registry, registerer: registerer})
+	}
+}
+
+// getRegistrations returns where the metric created by a constructor
+// call is registered.
+func getRegistrations(name string, c *ast.CallExpr, fset *token.FileSet, fi *fileInfo) []registration {
+	if strings.HasPrefix(name, "promauto.") {
+		pos := fset.Position(c.Pos())
+		reg := registration{path: pos.Filename, line: pos.Line, registry: "default", auto: "promauto"}
+		if reg.registerer = promautoRegisterer(c, fi); reg.registerer != nil {
+			reg.registry = types.ExprString(reg.registerer)
+			reg.wrapping = registererWrapping(reg.registerer, fi)
+		}
+		return []registration{reg}
+	}
+
+	regs := append([]registration(nil), fi.registrations[c]...)
+	if id, ok := fi.targets[c]; ok {
+		regs = append(regs, fi.registrations[fi.object(id)]...)
+	}
+	for i := range regs {
+		pos := fset.Position(regs[i].pos)
+		regs[i].path, regs[i].line = pos.Filename, pos.Line
+		if regs[i].registerer != nil {
+			regs[i].wrapping = registererWrapping(regs[i].registerer, fi)
+		}
+	}
+	return regs
+}
+
+// promautoRegisterer returns the registerer a promauto constructor call
+// registers its metric with, or nil for the default one.
+func promautoRegisterer(c *ast.CallExpr, fi *fileInfo) ast.Expr {
+	sel, ok := c.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return nil
+	}
+	switch x := sel.X.(type) {
+	case *ast.CallExpr:
+		if len(x.Args) == 1 {
+			return x.Args[0]
+		}
+	case *ast.Ident:
+		if reg, ok := fi.factories[fi.object(x)]; ok {
+			return reg
+		}
+	}
+	return nil
+}
+
+// registererWrapping follows a registerer expression through variables
+// and WrapRegistererWithPrefix/WrapRegistererWith calls to find what it
+// adds to the metrics registered through it.
+func registererWrapping(expr ast.Expr, fi *fileInfo) wrapping {
+	if id, ok := expr.(*ast.Ident); ok {
+		if val, ok := fi.values[fi.object(id)]; ok {
+			expr = val
+		}
+	}
+	c, ok := expr.(*ast.CallExpr)
+	if !ok || len(c.Args) != 2 {
+		return wrapping{}
+	}
+	switch getCallExprLiteral(c, fi) {
+	case "prometheus.WrapRegistererWithPrefix":
+		// The wrapped registerer prefixes the name again, so its prefix
+		// comes first.
+		w := registererWrapping(c.Args[1], fi)
+		prefix, _ := evalString(c.Args[0], fi)
+		w.prefix += prefix
+		return w
+	case "prometheus.WrapRegistererWith":
+		w := registererWrapping(c.Args[1], fi)
+		labels := getConstLabels(c.Args[0], fi)
+		if w.labels == nil {
+			w.labels = make(map[string]string, len(labels))
+		}
+		for k, v := range labels {
+			w.labels[k] = v
+		}
+		return w
+	}
+	return wrapping{}
+}
+
+// effectiveWrapping returns the wrapping of the first registration that
+// has one.
+func effectiveWrapping(regs []registration) wrapping {
+	for _, reg := range regs {
+		if reg.wrapping.prefix != "" || len(reg.wrapping.labels) > 0 {
+			return reg.wrapping
+		}
+	}
+	return wrapping{}
+}
+
+// formatRegistrations renders where a metric is registered, with the
+// registry in parentheses unless it is the default one.
+func formatRegistrations(regs []registration) string {
+	if len(regs) == 0 {
+		return "unregistered"
+	}
+	var parts []string
+	for _, reg := range regs {
+		part := fmt.Sprintf("%s:%d", reg.path, reg.line)
+		if reg.auto != "" {
+			part = reg.auto
+		}
+		if reg.registry != "default" {
+			part += "(" + reg.registry + ")"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ",")
+}
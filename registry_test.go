@@ -0,0 +1,94 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRegistrations(t *testing.T) {
+	hits := scanOne(t, `package m
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	requests = prometheus.NewCounter(prometheus.CounterOpts{Name: "requests_total"})
+	latency  = prometheus.NewHistogram(prometheus.HistogramOpts{Name: "latency_seconds"})
+	unused   = prometheus.NewGauge(prometheus.GaugeOpts{Name: "unused"})
+	auto     = promauto.NewCounter(prometheus.CounterOpts{Name: "auto_total"})
+	custom   = promauto.With(registry).NewCounter(prometheus.CounterOpts{Name: "custom_total"})
+)
+
+func init() {
+	prometheus.MustRegister(requests)
+	registry.MustRegister(requests, latency)
+	prometheus.Register(prometheus.NewGauge(prometheus.GaugeOpts{Name: "inline"}))
+}
+`)
+	want := map[string]string{
+		"requests_total":  "m.go:17,m.go:18(registry)",
+		"latency_seconds": "m.go:18(registry)",
+		"unused":          "unregistered",
+		"auto_total":      "promauto",
+		"custom_total":    "promauto(registry)",
+		"inline":          "m.go:19",
+	}
+	if len(hits) != len(want) {
+		t.Fatalf("got %v, want %d metrics", names(hits), len(want))
+	}
+	for _, hit := range hits {
+		for i := range hit.registrations {
+			hit.registrations[i].path = filepath.Base(hit.registrations[i].path)
+		}
+		if got := formatRegistrations(hit.registrations); got != want[hit.val] {
+			t.Errorf("%s registered %s, want %s", hit.val, got, want[hit.val])
+		}
+	}
+}
+
+func TestWrappedRegisterers(t *testing.T) {
+	src := `package m
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	reg     = prometheus.NewRegistry()
+	src     = prometheus.WrapRegistererWithPrefix("src_", reg)
+	sharded = prometheus.WrapRegistererWith(prometheus.Labels{"shard": "1"}, prometheus.WrapRegistererWithPrefix("inner_", src))
+
+	requests = prometheus.NewCounter(prometheus.CounterOpts{Name: "requests_total"})
+	jobs     = promauto.With(sharded).NewGauge(prometheus.GaugeOpts{Name: "jobs"})
+	plain    = prometheus.NewCounter(prometheus.CounterOpts{Name: "plain_total"})
+)
+
+func init() {
+	src.MustRegister(requests)
+	reg.MustRegister(plain)
+}
+`
+	hits := scanOne(t, src)
+	want := []struct{ name, declared, labels string }{
+		{"src_requests_total", "requests_total", ""},
+		{"src_inner_jobs", "jobs", `{shard="1"}`},
+		{"plain_total", "", ""},
+	}
+	if len(hits) != len(want) {
+		t.Fatalf("got %v, want %d metrics", names(hits), len(want))
+	}
+	for i, w := range want {
+		hit := hits[i]
+		if hit.val != w.name || hit.declaredName != w.declared || formatLabels(hit.constLabels, nil, "", nil) != w.labels {
+			t.Errorf("got %s%s declared %q, want %s%s declared %q", hit.val, formatLabels(hit.constLabels, nil, "", nil), hit.declaredName, w.name, w.labels, w.declared)
+		}
+	}
+
+	scored := scanSource(t, map[string]string{"m.go": src}, &matchName{name: "src_requests_total"})
+	if len(scored) == 0 || scored[0].val != "src_requests_total" || scored[0].score != 100 {
+		t.Errorf("src_requests_total found %v, want the wrapped requests_total with score 100", names(scored))
+	}
+}
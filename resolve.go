@@ -0,0 +1,51 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// checkPackage type checks the files of a package without loading its
+// imports, only to resolve its identifiers as the compiler does, across
+// files and with shadowing. The imported packages are empty, so the type
+// errors about them are expected and ignored.
+func checkPackage(fset *token.FileSet, files []*ast.File) (*types.Package, *types.Info) {
+	info := &types.Info{
+		Defs: make(map[*ast.Ident]types.Object),
+		Uses: make(map[*ast.Ident]types.Object),
+	}
+	conf := types.Config{
+		Importer:    emptyImporter{},
+		FakeImportC: true,
+		Error:       func(error) {},
+	}
+	pkg, _ := conf.Check(files[0].Name.Name, fset, files, info)
+	return pkg, info
+}
+
+// emptyImporter imports every package as an empty package named after
+// the last element of its import path.
+type emptyImporter struct{}
+
+func (emptyImporter) Import(importPath string) (*types.Package, error) {
+	pkg := types.NewPackage(importPath, importPath[strings.LastIndex(importPath, "/")+1:])
+	pkg.MarkComplete()
+	return pkg, nil
+}
+
+// object returns the variable, constant, function or type declared in
+// the package that an identifier declares or refers to, or nil for the
+// names of imports, the identifiers of other packages and the predeclared
+// ones.
+func (pi *pkgInfo) object(id *ast.Ident) types.Object {
+	obj := pi.objects.ObjectOf(id)
+	if obj == nil || obj.Pkg() != pi.types {
+		return nil
+	}
+	if _, ok := obj.(*types.PkgName); ok {
+		return nil
+	}
+	return obj
+}
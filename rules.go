@@ -0,0 +1,279 @@
+package main
+
+import (
+	"fmt"
+	"go/token"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ruleFile is a Prometheus rules file.
+type ruleFile struct {
+	Groups []struct {
+		Name  string `yaml:"name"`
+		Rules []rule `yaml:"rules"`
+	} `yaml:"groups"`
+}
+
+// rule is an alerting or recording rule. Record and Expr are kept as
+// nodes for their line numbers.
+type rule struct {
+	Alert  string    `yaml:"alert"`
+	Record yaml.Node `yaml:"record"`
+	Expr   yaml.Node `yaml:"expr"`
+}
+
+// rulesFile is a rules file read from the command line.
+type rulesFile struct {
+	path  string
+	rules []rule
+}
+
+// readRules reads the rules of a rules file.
+func readRules(path string) ([]rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rf ruleFile
+	if err := yaml.Unmarshal(data, &rf); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	var rules []rule
+	for _, group := range rf.Groups {
+		rules = append(rules, group.Rules...)
+	}
+	return rules, nil
+}
+
+// readRulesFiles reads the rules files, printing the errors on stderr.
+// ok is false if a file could not be read.
+func readRulesFiles(paths []string) (files []rulesFile, ok bool) {
+	ok = true
+	for _, path := range paths {
+		rules, err := readRules(path)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			ok = false
+			continue
+		}
+		files = append(files, rulesFile{path: path, rules: rules})
+	}
+	return files, ok
+}
+
+// recordedSeries returns where the series recorded by the rules are
+// defined, by name.
+func recordedSeries(files []rulesFile) map[string]token.Position {
+	recorded := make(map[string]token.Position)
+	for _, f := range files {
+		for _, r := range f.rules {
+			if r.Record.Value != "" {
+				recorded[r.Record.Value] = token.Position{Filename: f.path, Line: r.Record.Line}
+			}
+		}
+	}
+	return recorded
+}
+
+var (
+	// promqlStrings are the string literals of a PromQL expression.
+	promqlStrings = regexp.MustCompile(`"(\\.|[^"\\])*"|'(\\.|[^'\\])*'|` + "`[^`]*`")
+	// promqlNonMetrics are the parts of a PromQL expression that hold
+	// label names or durations rather than metric names.
+	promqlNonMetrics = regexp.MustCompile(`\{[^}]*\}|\[[^\]]*\]|\b(by|without|on|ignoring|group_left|group_right)\s*\([^)]*\)`)
+	// promqlIdent matches the identifiers of a PromQL expression, with
+	// the opening parenthesis of function calls.
+	promqlIdent = regexp.MustCompile(`[a-zA-Z_:][a-zA-Z0-9_:]*\s*\(?`)
+)
+
+// promqlKeywords are the PromQL keywords that look like metric names.
+var promqlKeywords = map[string]bool{
+	"and": true, "or": true, "unless": true, "bool": true, "offset": true,
+	"by": true, "without": true, "on": true, "ignoring": true,
+	"group_left": true, "group_right": true, "inf": true, "nan": true,
+}
+
+// exprMetrics approximates the metric names referenced in a PromQL
+// expression, in order of appearance and without duplicates.
+func exprMetrics(expr string) []string {
+	expr = promqlStrings.ReplaceAllString(expr, `""`)
+	expr = promqlNonMetrics.ReplaceAllString(expr, " ")
+
+	var names []string
+	seen := make(map[string]bool)
+	for _, token := range promqlIdent.FindAllString(expr, -1) {
+		if strings.HasSuffix(token, "(") {
+			// Function calls and aggregations.
+			continue
+		}
+		token = strings.TrimSpace(token)
+		if promqlKeywords[strings.ToLower(token)] || seen[token] {
+			continue
+		}
+		seen[token] = true
+		names = append(names, token)
+	}
+	return names
+}
+
+// rulesMinScore is the score below which a declaration is not taken as
+// the one of a metric referenced in a rule, unless --min-score is set.
+const rulesMinScore = 50
+
+// prometheusSeries are the series Prometheus itself generates.
+var prometheusSeries = map[string]bool{
+	"up":                                    true,
+	"ALERTS":                                true,
+	"ALERTS_FOR_STATE":                      true,
+	"scrape_duration_seconds":               true,
+	"scrape_samples_scraped":                true,
+	"scrape_samples_post_metric_relabeling": true,
+	"scrape_series_added":                   true,
+}
+
+// declarationRank ranks the declarations of a name by what they tell
+// about the metric: the Opts of a typed metric first, then the samples a
+// collector emits for a Desc, then the Desc alone.
+func declarationRank(hit matchResult) int {
+	switch {
+	case hit.kind == desc:
+		return 2
+	case hit.constMetric:
+		return 1
+	}
+	return 0
+}
+
+// bestDeclaration returns the declaration best matching a metric name
+// referenced in a rule, without the suffixes of histogram and summary
+// series. Of the declarations matching as well, the typed metric is
+// preferred over a Desc or the samples emitted for it.
+func bestDeclaration(name string, decls byScore, minScore int) (matchResult, bool) {
+	for _, suffix := range selectorSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			name = strings.TrimSuffix(name, suffix)
+			break
+		}
+	}
+	mn := &matchName{name: name}
+	var best matchResult
+	found := false
+	for _, decl := range decls {
+		hit, ok := mn.Match(promOpts{"Name": decl.val}, token.Position{})
+		if !ok || hit.score < minScore {
+			continue
+		}
+		if found && (hit.score < best.score || hit.score == best.score && declarationRank(decl) >= declarationRank(best)) {
+			continue
+		}
+		decl.score, decl.listed = hit.score, false
+		best, found = decl, true
+	}
+	return best, found
+}
+
+// knownDeclarations returns the declarations rules are resolved
+// against, and the minimum score of a match.
+func knownDeclarations(decls byScore) (byScore, int) {
+	var known byScore
+	for _, decl := range decls {
+		if !decl.generated || *includeGeneratedFlag {
+			known = append(known, decl)
+		}
+	}
+
+	minScore := rulesMinScore
+	if isFlagSet("min-score") {
+		minScore = *minScoreFlag
+	}
+	return known, minScore
+}
+
+// reportRules prints, for every metric referenced in the rules files,
+// the declaration best matching it, the recording rule defining it, or
+// NOT FOUND. Only the declarations kept by the filters of the flags are
+// looked at, so that --namespace or --exclude can rule out candidates. It
+// returns the exit status: 1 when a metric is not found.
+func reportRules(paths []string, decls byScore) int {
+	known, minScore := knownDeclarations(flagFilters().apply(decls))
+	files, ok := readRulesFiles(paths)
+	recorded := recordedSeries(files)
+
+	status := 0
+	if !ok {
+		status = 2
+	}
+	for _, f := range files {
+		for _, r := range f.rules {
+			name := r.Alert
+			if name == "" {
+				name = r.Record.Value
+			}
+			for _, metric := range exprMetrics(r.Expr.Value) {
+				fmt.Printf("%s:%d %s    %s -> ", f.path, r.Expr.Line, name, metric)
+				if prometheusSeries[metric] {
+					fmt.Println("generated by Prometheus")
+					continue
+				}
+				if pos, ok := recorded[metric]; ok {
+					fmt.Printf("recording rule %s:%d\n", pos.Filename, pos.Line)
+					continue
+				}
+				decl, ok := bestDeclaration(metric, known, minScore)
+				if !ok {
+					fmt.Println("NOT FOUND")
+					if status == 0 {
+						status = 1
+					}
+					continue
+				}
+				fmt.Printf("%s:%d %s %s score:%d\n", decl.path, decl.line, decl.val, decl.kind, decl.score)
+			}
+		}
+	}
+	return status
+}
+
+// recordingRules returns the recording rules of the rules files whose
+// names match mr, as hits telling the series they are derived from.
+func recordingRules(paths []string, mr matcher, decls byScore) byScore {
+	known, minScore := knownDeclarations(decls)
+	files, _ := readRulesFiles(paths)
+	recorded := recordedSeries(files)
+
+	var hits byScore
+	for _, f := range files {
+		for _, r := range f.rules {
+			if r.Record.Value == "" {
+				continue
+			}
+			hit, ok := mr.Match(promOpts{"Name": r.Record.Value}, token.Position{Filename: f.path, Line: r.Record.Line, Column: r.Record.Column})
+			if !ok {
+				continue
+			}
+			var sources []string
+			for _, metric := range exprMetrics(r.Expr.Value) {
+				source := metric
+				if prometheusSeries[metric] {
+					source += " (generated by Prometheus)"
+				} else if pos, ok := recorded[metric]; ok {
+					source += fmt.Sprintf(" (recording rule %s:%d)", pos.Filename, pos.Line)
+				} else if decl, ok := bestDeclaration(metric, known, minScore); ok {
+					source += fmt.Sprintf(" (declared %s:%d)", decl.path, decl.line)
+				} else {
+					source += " (NOT FOUND)"
+				}
+				sources = append(sources, source)
+			}
+			hit.kind = recordingRule
+			hit.help = r.Expr.Value
+			hit.derivedFrom = strings.Join(sources, ", ")
+			hits = append(hits, hit)
+		}
+	}
+	return hits
+}
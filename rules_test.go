@@ -0,0 +1,159 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestExprMetrics(t *testing.T) {
+	for expr, want := range map[string][]string{
+		`rate(src_http_requests_total{code=~"5.."}[5m]) > 0`:                  {"src_http_requests_total"},
+		`sum by (job) (up) == 0 and on(job) scrape_duration_seconds > 10`:     {"up", "scrape_duration_seconds"},
+		`histogram_quantile(0.99, sum(rate(latency_bucket[1m])) by (le)) > 1`: {"latency_bucket"},
+	} {
+		if got := exprMetrics(expr); !slices.Equal(got, want) {
+			t.Errorf("exprMetrics(%q) = %v, want %v", expr, got, want)
+		}
+	}
+}
+
+func TestBestDeclaration(t *testing.T) {
+	decls := scanSource(t, map[string]string{
+		"a.go": `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var jobsDesc = prometheus.NewDesc("jobs_total", "Jobs run.", nil, nil)
+
+type collector struct{}
+
+func (collector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(jobsDesc, prometheus.CounterValue, 1)
+}
+`,
+		"b.go": `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var jobs = prometheus.NewCounter(prometheus.CounterOpts{Name: "jobs_total", Help: "Jobs run."})
+`,
+	}, &matchAny{})
+	sort.SliceStable(decls, func(i, j int) bool { return decls[i].path < decls[j].path })
+	if len(decls) != 3 {
+		t.Fatalf("got %v, want a Desc, its samples and a counter", names(decls))
+	}
+
+	for _, tt := range []struct {
+		name  string
+		decls byScore
+		want  string
+	}{
+		{"all", decls, "b.go"},
+		{"reversed", byScore{decls[2], decls[1], decls[0]}, "b.go"},
+		{"without the counter", decls[:2], "a.go"},
+	} {
+		best, ok := bestDeclaration("jobs_total", tt.decls, 0)
+		if !ok || best.path != tt.want {
+			t.Errorf("%s: got %s:%d %v, want %s", tt.name, best.path, best.line, best.kind, tt.want)
+		}
+	}
+	if best, _ := bestDeclaration("jobs_total", decls[:2], 0); best.kind == desc {
+		t.Errorf("got the Desc, want the samples emitted for it")
+	}
+}
+
+func TestReportRulesFilters(t *testing.T) {
+	decls := scanSource(t, map[string]string{"m.go": `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	src  = prometheus.NewCounter(prometheus.CounterOpts{Namespace: "src", Name: "jobs_total"})
+	test = prometheus.NewCounter(prometheus.CounterOpts{Namespace: "test", Name: "jobs_total"})
+)
+`}, &matchAny{})
+	rules := filepath.Join(t.TempDir(), "alerts.yml")
+	if err := os.WriteFile(rules, []byte(`groups:
+- name: jobs
+  rules:
+  - alert: NoJobs
+    expr: rate(src_jobs_total[5m]) == 0 and rate(test_jobs_total[5m]) == 0
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		namespace string
+		want      []string
+		status    int
+	}{
+		{"", []string{"src_jobs_total -> m.go:6 src_jobs_total", "test_jobs_total -> m.go:7 test_jobs_total"}, 0},
+		{"src", []string{"src_jobs_total -> m.go:6 src_jobs_total", "test_jobs_total -> NOT FOUND"}, 1},
+	} {
+		setFlag(t, namespaceFlag, tt.namespace)
+		status := -1
+		out := captureStdout(t, func() {
+			status = reportRules([]string{rules}, decls)
+		})
+		for _, want := range tt.want {
+			if !strings.Contains(out, want) {
+				t.Errorf("--namespace=%q printed\n%s\nwant %q", tt.namespace, out, want)
+			}
+		}
+		if status != tt.status {
+			t.Errorf("--namespace=%q exited with %d, want %d", tt.namespace, status, tt.status)
+		}
+	}
+}
+
+func TestRecordingRules(t *testing.T) {
+	decls := scanSource(t, map[string]string{"m.go": `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var requests = prometheus.NewCounter(prometheus.CounterOpts{Namespace: "src", Name: "requests_total"})
+`}, &matchAny{})
+	rules := filepath.Join(t.TempDir(), "rules.yml")
+	if err := os.WriteFile(rules, []byte(`groups:
+- name: requests
+  rules:
+  - record: job:src_requests:rate5m
+    expr: sum by (job) (rate(src_requests_total[5m]))
+  - alert: NoRequests
+    expr: job:src_requests:rate5m == 0
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	hits := recordingRules([]string{rules}, &matchName{name: "job:src_requests:rate5m"}, decls)
+	if len(hits) != 1 {
+		t.Fatalf("got %v, want [job:src_requests:rate5m]", names(hits))
+	}
+	hit := hits[0]
+	if hit.kind != recordingRule || hit.path != rules || hit.line != 4 || hit.column != 13 {
+		t.Errorf("got %s:%d:%d %v, want %s:4:13 RecordingRule", hit.path, hit.line, hit.column, hit.kind, rules)
+	}
+	if want := "src_requests_total (declared m.go:5)"; hit.derivedFrom != want {
+		t.Errorf("derived from %q, want %q", hit.derivedFrom, want)
+	}
+
+	status := -1
+	out := captureStdout(t, func() {
+		status = reportRules([]string{rules}, decls)
+	})
+	for _, want := range []string{
+		"src_requests_total -> m.go:5 src_requests_total",
+		"job:src_requests:rate5m -> recording rule " + rules + ":4",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("reportRules printed\n%s\nwant %q", out, want)
+		}
+	}
+	if status != 0 {
+		t.Errorf("reportRules exited with %d, want 0", status)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// sarifCheck is a rule of the SARIF output.
+type sarifCheck struct {
+	id, description, level string
+}
+
+// sarifChecks are the rules of the SARIF output. The declarations are
+// informational results, so that the same pipeline can show the metrics
+// a change adds.
+var sarifChecks = []sarifCheck{
+	{"metric-declaration", "A Prometheus metric is declared here.", "note"},
+	{"missing-help", "The metric has no help string.", "warning"},
+	{"duplicate-name", "The metric name is declared in several places.", "warning"},
+}
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string            `json:"id"`
+	ShortDescription     sarifMessage      `json:"shortDescription"`
+	DefaultConfiguration sarifRuleDefaults `json:"defaultConfiguration"`
+}
+
+type sarifRuleDefaults struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// writeSARIF prints the hits as a SARIF 2.1.0 log, with a result per
+// declaration and per failed check.
+func writeSARIF(hits byScore) error {
+	var rules []sarifRule
+	for _, c := range sarifChecks {
+		rules = append(rules, sarifRule{
+			ID:                   c.id,
+			ShortDescription:     sarifMessage{Text: c.description},
+			DefaultConfiguration: sarifRuleDefaults{Level: c.level},
+		})
+	}
+
+	// Names declared more than once. The Desc of a metric declared at
+	// the same place, and the samples a collector emits for a Desc, are
+	// the same declaration.
+	described := make(map[string]bool)
+	for _, hit := range hits {
+		if hit.kind == desc {
+			described[hit.val] = true
+		}
+	}
+	locations := make(map[string]map[string]bool)
+	for _, hit := range hits {
+		if hit.val == "" || hit.dynamic || hit.kind == recordingRule || (hit.constMetric && described[hit.val]) {
+			continue
+		}
+		if locations[hit.val] == nil {
+			locations[hit.val] = make(map[string]bool)
+		}
+		locations[hit.val][fmt.Sprintf("%s:%d", hit.path, hit.line)] = true
+	}
+
+	results := make([]sarifResult, 0, len(hits))
+	for _, hit := range hits {
+		if hit.kind == recordingRule {
+			continue
+		}
+		results = append(results, newSARIFResult(0, hit, fmt.Sprintf("%s %s", hit.val, hit.kind)))
+		if strings.TrimSpace(hit.help) == "" && hit.kind != collector {
+			results = append(results, newSARIFResult(1, hit, fmt.Sprintf("%s has no help string", hit.val)))
+		}
+		if n := len(locations[hit.val]); n > 1 {
+			results = append(results, newSARIFResult(2, hit, fmt.Sprintf("%s is declared in %d places", hit.val, n)))
+		}
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "promgrep",
+				InformationURI: "https://github.com/sourcegraph/promgrep",
+				Rules:          rules,
+			}},
+			Results: results,
+		}},
+	})
+}
+
+// newSARIFResult returns the result of the check of sarifChecks at
+// index i for a hit.
+func newSARIFResult(i int, hit matchResult, message string) sarifResult {
+	return sarifResult{
+		RuleID:    sarifChecks[i].id,
+		RuleIndex: i,
+		Level:     sarifChecks[i].level,
+		Message:   sarifMessage{Text: message},
+		Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+			ArtifactLocation: sarifArtifactLocation{URI: sarifURI(hit.path)},
+			Region:           sarifRegion{StartLine: hit.line, StartColumn: hit.column},
+		}}},
+	}
+}
+
+// sarifURI returns a relative URI reference for a file path.
+func sarifURI(path string) string {
+	return strings.ReplaceAll(path, string(os.PathSeparator), "/")
+}
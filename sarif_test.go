@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const sarifCollector = `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+type collector struct{}
+
+var queueDesc = prometheus.NewDesc("queue_length", "Queue length.", nil, nil)
+
+func (collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- queueDesc
+}
+
+func (collector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(queueDesc, prometheus.GaugeValue, 1)
+}
+
+var a = prometheus.NewCounter(prometheus.CounterOpts{Name: "dup_total", Help: "Once."})
+var b = prometheus.NewCounter(prometheus.CounterOpts{Name: "dup_total"})
+`
+
+// TestSARIF checks the log against the parts of the SARIF 2.1.0 schema
+// that apply to it: the properties each object requires, the properties
+// it allows, the version, the levels and the minimums of the rule indexes
+// and regions. It also checks that the rule indexes point to their rules.
+func TestSARIF(t *testing.T) {
+	hits := scanOne(t, sarifCollector)
+	out := captureStdout(t, func() {
+		if err := writeSARIF(hits); err != nil {
+			t.Fatal(err)
+		}
+	})
+	var doc any
+	if err := json.Unmarshal([]byte(out), &doc); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+
+	log := sarifObject(t, "sarifLog", doc, []string{"version", "runs"}, "$schema")
+	if log["version"] != "2.1.0" {
+		t.Errorf("version %v, want 2.1.0", log["version"])
+	}
+	if schema, _ := log["$schema"].(string); !strings.Contains(schema, "sarif-2.1.0") {
+		t.Errorf("$schema %q", schema)
+	}
+	runs := sarifArray(t, "runs", log["runs"])
+	if len(runs) != 1 {
+		t.Fatalf("%d runs, want 1", len(runs))
+	}
+	run := sarifObject(t, "run", runs[0], []string{"tool"}, "results")
+	tool := sarifObject(t, "tool", run["tool"], []string{"driver"})
+	driver := sarifObject(t, "toolComponent", tool["driver"], []string{"name"}, "informationUri", "rules")
+	if driver["name"] != "promgrep" {
+		t.Errorf("driver %v", driver["name"])
+	}
+	var ruleIDs []string
+	for _, r := range sarifArray(t, "rules", driver["rules"]) {
+		rule := sarifObject(t, "reportingDescriptor", r, []string{"id"}, "shortDescription", "defaultConfiguration")
+		sarifObject(t, "multiformatMessageString", rule["shortDescription"], []string{"text"})
+		config := sarifObject(t, "reportingConfiguration", rule["defaultConfiguration"], nil, "level")
+		sarifLevel(t, rule["id"], config["level"])
+		id, _ := rule["id"].(string)
+		ruleIDs = append(ruleIDs, id)
+	}
+
+	duplicates := make(map[string]int)
+	for _, r := range sarifArray(t, "results", run["results"]) {
+		result := sarifObject(t, "result", r, []string{"message"}, "ruleId", "ruleIndex", "level", "locations")
+		id, _ := result["ruleId"].(string)
+		index, ok := result["ruleIndex"].(float64)
+		if !ok || index < -1 || int(index) >= len(ruleIDs) || ruleIDs[int(index)] != id {
+			t.Errorf("result of %s has rule index %v", id, result["ruleIndex"])
+		}
+		sarifLevel(t, id, result["level"])
+		message := sarifObject(t, "message", result["message"], []string{"text"})
+		text, _ := message["text"].(string)
+		locations := sarifArray(t, "locations", result["locations"])
+		if len(locations) != 1 {
+			t.Errorf("result of %s has %d locations", id, len(locations))
+			continue
+		}
+		location := sarifObject(t, "location", locations[0], nil, "physicalLocation")
+		physical := sarifObject(t, "physicalLocation", location["physicalLocation"], []string{"artifactLocation"}, "region")
+		artifact := sarifObject(t, "artifactLocation", physical["artifactLocation"], nil, "uri")
+		region := sarifObject(t, "region", physical["region"], nil, "startLine", "startColumn")
+		if artifact["uri"] != "m.go" {
+			t.Errorf("result of %s in %v", id, artifact["uri"])
+		}
+		for _, p := range []string{"startLine", "startColumn"} {
+			if n, ok := region[p].(float64); !ok || n < 1 {
+				t.Errorf("result of %s has %s %v, want at least 1", id, p, region[p])
+			}
+		}
+		if id == "duplicate-name" {
+			duplicates[strings.Fields(text)[0]]++
+		}
+	}
+
+	// The samples emitted for queueDesc are not a second declaration.
+	if want := map[string]int{"dup_total": 2}; len(duplicates) != 1 || duplicates["dup_total"] != 2 {
+		t.Errorf("duplicate-name results %v, want %v", duplicates, want)
+	}
+}
+
+// sarifObject checks that v is an object of the SARIF schema definition
+// def with the required properties, and no properties other than those
+// and the optional ones, as the schema allows none.
+func sarifObject(t *testing.T, def string, v any, required []string, optional ...string) map[string]any {
+	t.Helper()
+	obj, ok := v.(map[string]any)
+	if !ok {
+		t.Fatalf("%s is %T, want an object", def, v)
+	}
+	for _, p := range required {
+		if _, ok := obj[p]; !ok {
+			t.Errorf("%s has no %s", def, p)
+		}
+	}
+	for p := range obj {
+		if !slices.Contains(required, p) && !slices.Contains(optional, p) {
+			t.Errorf("%s has the unexpected property %s", def, p)
+		}
+	}
+	return obj
+}
+
+// sarifArray checks that v is an array.
+func sarifArray(t *testing.T, name string, v any) []any {
+	t.Helper()
+	a, ok := v.([]any)
+	if !ok {
+		t.Fatalf("%s is %T, want an array", name, v)
+	}
+	return a
+}
+
+// sarifLevel checks that a level is one of the schema.
+func sarifLevel(t *testing.T, id, level any) {
+	t.Helper()
+	switch level {
+	case "none", "note", "warning", "error":
+	default:
+		t.Errorf("%v has level %v", id, level)
+	}
+}
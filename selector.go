@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// labelMatcher is a label matcher of a PromQL selector, such as
+// route="graphql".
+type labelMatcher struct {
+	name  string
+	op    string
+	value string
+}
+
+// selectorSuffixes are the suffixes of the series exposed for histograms
+// and summaries, stripped from selectors to get the metric name.
+var selectorSuffixes = []string{"_bucket", "_sum", "_count"}
+
+// isSelector reports whether a query is a PromQL selector such as
+// name{label="value"}.
+func isSelector(query string) bool {
+	return strings.Contains(query, "{")
+}
+
+// parseSelector parses a PromQL selector into the name of the metric,
+// without the suffixes of histogram and summary series, and its label
+// matchers.
+func parseSelector(selector string) (string, []labelMatcher, error) {
+	i := strings.IndexByte(selector, '{')
+	if !strings.HasSuffix(selector, "}") {
+		return "", nil, fmt.Errorf("missing closing brace")
+	}
+	name := strings.TrimSpace(selector[:i])
+	if name != "" && !isMetricName(name) {
+		return "", nil, fmt.Errorf("invalid metric name %q", name)
+	}
+
+	var matchers []labelMatcher
+	rest := strings.TrimSpace(selector[i+1 : len(selector)-1])
+	for rest != "" {
+		j := 0
+		for j < len(rest) && isLabelChar(rest[j], j == 0) {
+			j++
+		}
+		if j == 0 {
+			return "", nil, fmt.Errorf("expected label name at %q", rest)
+		}
+		m := labelMatcher{name: rest[:j]}
+		rest = strings.TrimSpace(rest[j:])
+
+		for _, op := range []string{"=~", "!~", "!=", "="} {
+			if strings.HasPrefix(rest, op) {
+				m.op = op
+				break
+			}
+		}
+		if m.op == "" {
+			return "", nil, fmt.Errorf("expected matcher operator after %s", m.name)
+		}
+		rest = strings.TrimSpace(rest[len(m.op):])
+
+		value, n, err := selectorValue(rest)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid value of %s: %v", m.name, err)
+		}
+		m.value = value
+		rest = strings.TrimSpace(rest[n:])
+		if rest != "" {
+			if rest[0] != ',' {
+				return "", nil, fmt.Errorf("expected comma at %q", rest)
+			}
+			rest = strings.TrimSpace(rest[1:])
+		}
+
+		if m.name == "__name__" && m.op == "=" {
+			name = m.value
+			continue
+		}
+		matchers = append(matchers, m)
+	}
+	if name == "" {
+		return "", nil, fmt.Errorf("missing metric name")
+	}
+
+	for _, suffix := range selectorSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			name = strings.TrimSuffix(name, suffix)
+			break
+		}
+	}
+	return name, matchers, nil
+}
+
+// parseSelectors replaces the selectors among the queries with the names
+// of their metrics, and returns their label matchers by the query of the
+// hits they apply to: the name, or "" when there is a single query, as
+// the hits of a single query have none.
+func parseSelectors(queries []string) (map[string][]labelMatcher, error) {
+	selectors := make(map[string][]labelMatcher)
+	for i, query := range queries {
+		if !isSelector(query) {
+			continue
+		}
+		name, matchers, err := parseSelector(query)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %v", query, err)
+		}
+		queries[i] = name
+		key := name
+		if len(queries) == 1 {
+			key = ""
+		}
+		selectors[key] = append(selectors[key], matchers...)
+	}
+	return selectors, nil
+}
+
+// selectorValue decodes the quoted string at the start of s and returns
+// it with the length it takes.
+func selectorValue(s string) (string, int, error) {
+	if strings.HasPrefix(s, "'") {
+		// Single-quoted strings are not Go string literals; their
+		// escapes are not decoded.
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return "", 0, fmt.Errorf("unterminated string")
+		}
+		return s[1 : end+1], end + 2, nil
+	}
+	quoted, err := strconv.QuotedPrefix(s)
+	if err != nil {
+		return "", 0, fmt.Errorf("expected quoted string at %q", s)
+	}
+	value, err := strconv.Unquote(quoted)
+	return value, len(quoted), err
+}
+
+// isMetricName reports whether name is a valid metric name.
+func isMetricName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if !isLabelChar(name[i], i == 0) && name[i] != ':' {
+			return false
+		}
+	}
+	return true
+}
+
+// isLabelChar reports whether c can appear in a label name, at its start
+// if first is set.
+func isLabelChar(c byte, first bool) bool {
+	switch {
+	case c == '_', 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		return true
+	case '0' <= c && c <= '9':
+		return !first
+	}
+	return false
+}
+
+// selectorIgnoredLabels are the labels of selectors that are not looked
+// for in the code: __name__ is the name, le and quantile are implied by
+// the kind of histograms and summaries, and job and instance are added
+// by Prometheus to the scraped series. --label still requires them.
+var selectorIgnoredLabels = map[string]bool{
+	"__name__": true,
+	"le":       true,
+	"quantile": true,
+	"job":      true,
+	"instance": true,
+}
+
+// requiresLabel reports whether a matcher needs its label to be set: a
+// missing label has the empty value, which some matchers accept, such as
+// code!="500".
+func (m labelMatcher) requiresLabel() bool {
+	switch m.op {
+	case "=":
+		return m.value != ""
+	case "!=":
+		return m.value == ""
+	}
+	re, err := regexp.Compile("^(?:" + m.value + ")$")
+	if err != nil {
+		return true
+	}
+	return re.MatchString("") == (m.op == "!~")
+}
+
+// selectorFilter keeps the hits having the labels required by the
+// matchers of the selector they matched, as variable or const labels.
+// The matchers are by query, as in the query of the hits, and "" when
+// there is a single query. Hits whose labels are not known statically
+// are kept.
+func selectorFilter(selectors map[string][]labelMatcher) filter {
+	required := make(map[string]filter)
+	for query, matchers := range selectors {
+		var names []string
+		for _, m := range matchers {
+			if !selectorIgnoredLabels[m.name] && m.requiresLabel() {
+				names = append(names, m.name)
+			}
+		}
+		required[query] = labelsFilter(names)
+	}
+	return func(hit matchResult) bool {
+		has, ok := required[hit.query]
+		return !ok || hit.labelsExpr != "" || has(hit)
+	}
+}
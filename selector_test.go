@@ -0,0 +1,85 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSelectorFilter(t *testing.T) {
+	hits := byScore{
+		{val: "req_duration_seconds", kind: histogram},
+		{val: "fetch_total", kind: counter, labels: []string{"code"}, query: "fetch_total"},
+		{val: "queue_length", kind: gauge, query: "queue_length"},
+	}
+	for _, tt := range []struct {
+		queries []string
+		want    []string
+	}{
+		{[]string{`req_duration_seconds_bucket{le="0.5"}`}, []string{"req_duration_seconds"}},
+		{[]string{`req_duration_seconds_count{job="api",instance=~"a.*"}`}, []string{"req_duration_seconds"}},
+		{[]string{`req_duration_seconds{code="200"}`}, nil},
+		{[]string{`req_duration_seconds{code!="500"}`}, []string{"req_duration_seconds"}},
+		{[]string{`req_duration_seconds{code=~"2..|"}`}, []string{"req_duration_seconds"}},
+		// Each selector only filters its own hits.
+		{[]string{`fetch_total{code="200"}`, `queue_length{shard="1"}`}, []string{"fetch_total"}},
+		{[]string{`fetch_total{code="200"}`, `queue_length`}, []string{"fetch_total", "queue_length"}},
+	} {
+		selectors, err := parseSelectors(slices.Clone(tt.queries))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var candidates byScore
+		for _, hit := range hits {
+			if len(tt.queries) == 1 || hit.query != "" {
+				candidates = append(candidates, hit)
+			}
+		}
+		if len(tt.queries) == 1 {
+			candidates = candidates[:1]
+		}
+		got := names(filters{selectorFilter(selectors)}.apply(candidates))
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%v: got %v, want %v", tt.queries, got, tt.want)
+		}
+	}
+}
+
+func TestParseSelectors(t *testing.T) {
+	for _, tt := range []struct {
+		queries     []string
+		wantQueries []string
+		want        map[string][]labelMatcher
+	}{
+		{
+			[]string{`req_duration_seconds_bucket{le="0.5", code=~'2..'}`},
+			[]string{"req_duration_seconds"},
+			map[string][]labelMatcher{"": {{"le", "=", "0.5"}, {"code", "=~", "2.."}}},
+		},
+		{
+			[]string{`{__name__="fetch_total",code!="500"}`, "queue_length", `fetch_total{shard="1"}`},
+			[]string{"fetch_total", "queue_length", "fetch_total"},
+			map[string][]labelMatcher{"fetch_total": {{"code", "!=", "500"}, {"shard", "=", "1"}}},
+		},
+		{[]string{"queue_length"}, []string{"queue_length"}, map[string][]labelMatcher{}},
+	} {
+		queries := slices.Clone(tt.queries)
+		got, err := parseSelectors(queries)
+		if err != nil {
+			t.Errorf("%v: %v", tt.queries, err)
+			continue
+		}
+		if !slices.Equal(queries, tt.wantQueries) {
+			t.Errorf("%v: queries became %v, want %v", tt.queries, queries, tt.wantQueries)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: got %v, want %v", tt.queries, got, tt.want)
+		}
+	}
+
+	if _, err := parseSelectors([]string{"ok", `bad{code=200}`}); err == nil || !strings.Contains(err.Error(), `"bad{code=200}"`) {
+		t.Errorf("got error %v, want the invalid selector", err)
+	}
+}
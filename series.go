@@ -0,0 +1,85 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// quantileSuffix matches the suffixes dashboards render the quantile
+	// of a summary into, such as _p95, _quantile_99 or _0_99.
+	quantileSuffix = regexp.MustCompile(`_(p[0-9]+|quantile(_[0-9]+)?|0[._][0-9]+)$`)
+	// leSuffix matches the suffixes rendering the upper bound of a
+	// histogram bucket into the name, such as _le_0_5 or _bucket_le_inf.
+	leSuffix = regexp.MustCompile(`_(bucket_)?le_([0-9]+([._][0-9]+)?|inf)$`)
+)
+
+// seriesSuffix returns the suffix of the histogram or summary series a
+// name ends with, or "".
+func seriesSuffix(name string) string {
+	for _, suffix := range selectorSuffixes {
+		if strings.HasSuffix(name, suffix) && len(name) > len(suffix) {
+			return suffix
+		}
+	}
+	for _, re := range []*regexp.Regexp{leSuffix, quantileSuffix} {
+		if loc := re.FindStringIndex(name); loc != nil && loc[0] > 0 {
+			return name[loc[0]:]
+		}
+	}
+	return ""
+}
+
+// seriesHits checks the hits matched through the suffix of a series
+// against their kind of metric. The hits whose kind does not expose the
+// series fall back to the match of the query as written, or are dropped
+// when it does not match.
+func seriesHits(hits byScore) byScore {
+	var kept byScore
+	for _, hit := range hits {
+		if !exposesSeries(hit) {
+			if hit.plain == nil {
+				continue
+			}
+			hit.score, hit.matched, hit.series = hit.plain.score, hit.plain.matched, ""
+		}
+		hit.plain = nil
+		kept = append(kept, hit)
+	}
+	return kept
+}
+
+// exposesSeries reports whether the kind of metric of a hit exposes the
+// series it matched through. Untyped metrics and descs may be of any
+// kind.
+func exposesSeries(hit matchResult) bool {
+	if hit.series == "" {
+		return true
+	}
+	switch hit.kind {
+	case gauge, counter:
+		return false
+	case histogram:
+		return leSuffix.MatchString(hit.series) || !quantileSuffix.MatchString(hit.series)
+	case summary:
+		return hit.series != "_bucket" && !leSuffix.MatchString(hit.series)
+	}
+	return true
+}
+
+// ruleSegment returns the longest colon-separated segment of a query
+// that looks like a recording rule name, level:metric:operations, or ""
+// for other queries.
+func ruleSegment(query string) string {
+	segments := strings.Split(query, ":")
+	if len(segments) < 2 {
+		return ""
+	}
+	longest := ""
+	for _, segment := range segments {
+		if len(segment) > len(longest) {
+			longest = segment
+		}
+	}
+	return longest
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"go/token"
+	"strings"
+)
+
+// matchTokens matches the qualified metric names containing all the
+// words of the query as underscore separated tokens, in any order.
+type matchTokens struct {
+	tokens []string
+}
+
+func (mt *matchTokens) Match(opts promOpts, pos token.Position) (matchResult, bool) {
+	qmn := qualifiedMetricName(opts)
+	names := splitTokens(qmn)
+	if len(mt.tokens) == 0 || len(names) == 0 {
+		return matchResult{}, false
+	}
+
+	// Each query token takes the first unused name token equal to it.
+	used := make([]bool, len(names))
+	positions := make([]int, len(mt.tokens))
+	for i, t := range mt.tokens {
+		positions[i] = -1
+		for j, name := range names {
+			if !used[j] && name == t {
+				used[j], positions[i] = true, j
+				break
+			}
+		}
+		if positions[i] < 0 {
+			return matchResult{}, false
+		}
+	}
+
+	// Most of the score is the share of the name the query covers; the
+	// rest rewards query tokens that follow each other in the name.
+	adjacency := 20
+	if len(positions) > 1 {
+		adjacent := 0
+		for i := 1; i < len(positions); i++ {
+			if positions[i] == positions[i-1]+1 {
+				adjacent++
+			}
+		}
+		adjacency = adjacent * 20 / (len(positions) - 1)
+	}
+	score := len(mt.tokens)*80/len(names) + adjacency
+
+	return matchResult{
+		score:  score,
+		path:   pos.Filename,
+		line:   pos.Line,
+		column: pos.Column,
+		val:    qmn,
+		help:   opts["Help"],
+	}, true
+}
+
+// splitTokens splits a query or a metric name into lowercase words at
+// spaces, underscores, colons and dashes.
+func splitTokens(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return r == ' ' || r == '-' || r == ':' || r == '_'
+	})
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTokens(t *testing.T) {
+	src := `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	a = prometheus.NewHistogram(prometheus.HistogramOpts{Namespace: "src", Subsystem: "gitserver", Name: "fetch_duration_seconds"})
+	b = prometheus.NewHistogram(prometheus.HistogramOpts{Namespace: "src", Subsystem: "gitserver", Name: "exec_duration_seconds"})
+	c = prometheus.NewCounter(prometheus.CounterOpts{Namespace: "src", Subsystem: "frontend", Name: "fetch_total"})
+)
+`
+	for _, tt := range []struct {
+		query string
+		want  []string
+		score int
+	}{
+		// 3 of the 5 tokens, in order.
+		{"gitserver fetch duration", []string{"src_gitserver_fetch_duration_seconds"}, 68},
+		// 3 of the 5 tokens, gitserver out of place.
+		{"fetch duration gitserver", []string{"src_gitserver_fetch_duration_seconds"}, 58},
+		{"Duration Gitserver", []string{"src_gitserver_exec_duration_seconds", "src_gitserver_fetch_duration_seconds"}, 32},
+		{"fetch fetch", nil, 0},
+		{"gitserver total", nil, 0},
+	} {
+		hits := scanSource(t, map[string]string{"m.go": src}, newMatcher(tt.query))
+		got := names(hits)
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%q found %v, want %v", tt.query, got, tt.want)
+			continue
+		}
+		for _, hit := range hits {
+			if hit.score != tt.score {
+				t.Errorf("%q found %s with score %d, want %d", tt.query, hit.val, hit.score, tt.score)
+			}
+		}
+	}
+}
+
+func TestSplitTokens(t *testing.T) {
+	got := splitTokens(" src_gitserver-Fetch:rate5m  duration ")
+	if want := []string{"src", "gitserver", "fetch", "rate5m", "duration"}; !slices.Equal(got, want) {
+		t.Errorf("splitTokens() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// treeNoNamespace is the node of the metrics without a Namespace in the
+// dot and tree outputs.
+const treeNoNamespace = "(none)"
+
+// metricTree holds the metrics by Namespace and Subsystem, "" for the
+// metrics without a Subsystem, as sorted "name (Kind)" leaves.
+type metricTree map[string]map[string][]string
+
+// newMetricTree returns the hierarchy of the hits. The namespaces are the
+// Namespace of the Opts, not a prefix of the name, so that names with a
+// namespace baked in stand out.
+func newMetricTree(hits byScore) metricTree {
+	tree := make(metricTree)
+	seen := make(map[string]bool)
+	for _, hit := range hits {
+		if hit.kind == recordingRule {
+			continue
+		}
+		ns, subsystem := hit.opts["Namespace"], hit.opts["Subsystem"]
+		if ns == "" {
+			ns = treeNoNamespace
+		}
+		name := hit.val
+		if name == "" {
+			name = "<" + hit.nameExpr + ">"
+		}
+		leaf := fmt.Sprintf("%s (%s)", name, hit.kind)
+		key := ns + "\x00" + subsystem + "\x00" + leaf
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if tree[ns] == nil {
+			tree[ns] = make(map[string][]string)
+		}
+		tree[ns][subsystem] = append(tree[ns][subsystem], leaf)
+	}
+	for _, subsystems := range tree {
+		for _, leaves := range subsystems {
+			sort.Strings(leaves)
+		}
+	}
+	return tree
+}
+
+// writeTree prints the hierarchy of namespaces, subsystems and metrics
+// as an indented tree.
+func writeTree(hits byScore) error {
+	tree := newMetricTree(hits)
+	for _, ns := range sortedKeys(tree) {
+		fmt.Println(ns)
+		subsystems := sortedKeys(tree[ns])
+		for i, subsystem := range subsystems {
+			last := i == len(subsystems)-1
+			if subsystem == "" {
+				printTreeLeaves(tree[ns][subsystem], "", last)
+				continue
+			}
+			branch, indent := "├── ", "│   "
+			if last {
+				branch, indent = "└── ", "    "
+			}
+			fmt.Println(branch + subsystem)
+			printTreeLeaves(tree[ns][subsystem], indent, true)
+		}
+	}
+	return nil
+}
+
+// printTreeLeaves prints the metrics of a node under prefix. last tells
+// whether they end the node, as nothing follows them.
+func printTreeLeaves(leaves []string, prefix string, last bool) {
+	for i, leaf := range leaves {
+		branch := "├── "
+		if last && i == len(leaves)-1 {
+			branch = "└── "
+		}
+		fmt.Println(prefix + branch + leaf)
+	}
+}
+
+// writeDot prints the hierarchy of namespaces, subsystems and metrics as
+// a Graphviz graph. Everything is sorted, so that the graph can be
+// committed and diffed.
+func writeDot(hits byScore) error {
+	tree := newMetricTree(hits)
+	fmt.Println("digraph metrics {")
+	fmt.Println("\trankdir=LR;")
+	fmt.Println("\tnode [shape=box];")
+	for _, ns := range sortedKeys(tree) {
+		nsID := strconv.Quote("ns/" + ns)
+		fmt.Printf("\t%s [label=%s, shape=folder];\n", nsID, strconv.Quote(ns))
+		for _, subsystem := range sortedKeys(tree[ns]) {
+			parent := nsID
+			if subsystem != "" {
+				parent = strconv.Quote("ns/" + ns + "/" + subsystem)
+				fmt.Printf("\t%s [label=%s, shape=tab];\n", parent, strconv.Quote(subsystem))
+				fmt.Printf("\t%s -> %s;\n", nsID, parent)
+			}
+			for _, leaf := range tree[ns][subsystem] {
+				id := strconv.Quote("metric/" + ns + "/" + subsystem + "/" + leaf)
+				label := strconv.Quote(strings.Replace(leaf, " (", "\n(", 1))
+				fmt.Printf("\t%s [label=%s, shape=ellipse];\n", id, label)
+				fmt.Printf("\t%s -> %s;\n", parent, id)
+			}
+		}
+	}
+	fmt.Println("}")
+	return nil
+}
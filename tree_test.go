@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMetricTree(t *testing.T) {
+	hits := byScore{
+		{val: "src_http_requests_total", kind: counter, opts: promOpts{"Namespace": "src", "Subsystem": "http", "Name": "requests_total"}},
+		{val: "src_http_requests_total", kind: counter, opts: promOpts{"Namespace": "src", "Subsystem": "http", "Name": "requests_total"}},
+		{val: "src_jobs_total", kind: counter, opts: promOpts{"Namespace": "src", "Name": "jobs_total"}},
+		{val: "src_up", kind: gauge, opts: promOpts{"Name": "src_up"}},
+		{val: "job:src_up:sum", kind: recordingRule},
+	}
+
+	out := captureStdout(t, func() {
+		if err := writeTree(hits); err != nil {
+			t.Fatal(err)
+		}
+	})
+	want := `(none)
+└── src_up (Gauge)
+src
+├── src_jobs_total (Counter)
+└── http
+    └── src_http_requests_total (Counter)
+`
+	if out != want {
+		t.Errorf("the tree is\n%s\nwant\n%s", out, want)
+	}
+
+	out = captureStdout(t, func() {
+		if err := writeDot(hits); err != nil {
+			t.Fatal(err)
+		}
+	})
+	want = `digraph metrics {
+	rankdir=LR;
+	node [shape=box];
+	"ns/(none)" [label="(none)", shape=folder];
+	"metric/(none)//src_up (Gauge)" [label="src_up\n(Gauge)", shape=ellipse];
+	"ns/(none)" -> "metric/(none)//src_up (Gauge)";
+	"ns/src" [label="src", shape=folder];
+	"metric/src//src_jobs_total (Counter)" [label="src_jobs_total\n(Counter)", shape=ellipse];
+	"ns/src" -> "metric/src//src_jobs_total (Counter)";
+	"ns/src/http" [label="http", shape=tab];
+	"ns/src" -> "ns/src/http";
+	"metric/src/http/src_http_requests_total (Counter)" [label="src_http_requests_total\n(Counter)", shape=ellipse];
+	"ns/src/http" -> "metric/src/http/src_http_requests_total (Counter)";
+}
+`
+	if out != want {
+		t.Errorf("the graph is\n%s\nwant\n%s", out, want)
+	}
+}
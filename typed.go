@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/types"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// processTyped loads and type checks the packages below the current
+// directory and inspects their files with type information, so that
+// constants declared in other packages resolve and constructors are
+// recognized by the package that declares them rather than by name.
+// The hits of each package are passed to emit. The dependencies are
+// loaded from export data rather than type checked, and packages that do
+// not load or type check are an error, as their hits would be missing.
+func processTyped(mr matcher, emit func(byScore)) error {
+	cfg := &packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedSyntax |
+			packages.NeedTypes | packages.NeedTypesInfo | packages.NeedImports,
+		Tests: *includeTestsFlag,
+	}
+	pkgs, err := packages.Load(cfg, "./...")
+	if err != nil {
+		return err
+	}
+	if n := packages.PrintErrors(pkgs); n > 0 {
+		return fmt.Errorf("%d errors loading packages", n)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	for _, pkg := range pkgs {
+		if pkg.TypesInfo == nil {
+			continue
+		}
+
+		pi := newPkgInfo(pkg.Types, pkg.TypesInfo, pkg.Syntax)
+		infos := make([]*fileInfo, len(pkg.Syntax))
+		for i, tree := range pkg.Syntax {
+			infos[i] = collectFileInfo(tree, pi)
+			infos[i].info = pkg.TypesInfo
+			infos[i].test = isTestFile(pkg.Fset.File(tree.Pos()).Name())
+		}
+
+		// The test variant of a package, such as "p [p.test]", repeats
+		// the files of the package, so only its test files are inspected.
+		variant := pkg.ID != pkg.PkgPath
+
+		var accum byScore
+		for i, tree := range pkg.Syntax {
+			if !importsClientPackage(tree) || (variant && !infos[i].test) {
+				continue
+			}
+			start := len(accum)
+			fi := infos[i]
+			ast.Inspect(tree, func(node ast.Node) bool {
+				return inspect(pkg.Fset, fi, node, mr, &accum) == nil
+			})
+			for j := start; j < len(accum); j++ {
+				accum[j].pkg = pkg.Name
+				if rel, err := filepath.Rel(wd, accum[j].path); err == nil {
+					accum[j].path = rel
+				}
+			}
+		}
+		emit(accum)
+	}
+	return nil
+}
+
+// typedSelectorLiteral renders a reference to a function, variable or
+// constant of a client package using type information, or returns "".
+func typedSelectorLiteral(expr ast.Expr, info *types.Info) string {
+	var id *ast.Ident
+	switch e := expr.(type) {
+	case *ast.Ident:
+		id = e
+	case *ast.SelectorExpr:
+		id = e.Sel
+	default:
+		return ""
+	}
+	obj := info.Uses[id]
+	if obj == nil || obj.Pkg() == nil {
+		return ""
+	}
+	pkg, ok := clientPackage(obj.Pkg().Path())
+	if !ok {
+		return ""
+	}
+	return pkg + "." + obj.Name()
+}
+
+// typedString returns the value of a constant string expression.
+func typedString(expr ast.Expr, info *types.Info) (string, bool) {
+	tv, ok := info.Types[expr]
+	if !ok || tv.Value == nil || tv.Value.Kind() != constant.String {
+		return "", false
+	}
+	return constant.StringVal(tv.Value), true
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// writeModule writes the files of a module example.com/m, by path, to a
+// temporary directory and changes to it.
+func writeModule(t *testing.T, files map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	files["go.mod"] = "module example.com/m\n\ngo 1.22\n"
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+}
+
+// forkedClient is a stand-in for client_golang, recognized by the
+// trailing elements of its import path.
+const forkedClient = `package prometheus
+
+type CounterOpts struct{ Namespace, Subsystem, Name, Help string }
+
+type Counter interface{ Inc() }
+
+func NewCounter(opts CounterOpts) Counter { return nil }
+`
+
+func TestTyped(t *testing.T) {
+	writeModule(t, map[string]string{
+		"client_golang/prometheus/prometheus.go": forkedClient,
+		"metricnames/names.go": `package metricnames
+
+const (
+	Namespace = "src"
+	Subsystem = Namespace + "_worker"
+)
+`,
+		"svc/svc.go": `package svc
+
+import (
+	"example.com/m/metricnames"
+	prom "example.com/m/client_golang/prometheus"
+)
+
+var (
+	a = prom.NewCounter(prom.CounterOpts{Namespace: metricnames.Namespace, Name: "jobs_total"})
+	b = prom.NewCounter(prom.CounterOpts{Namespace: "x", Subsystem: metricnames.Subsystem, Name: "errors_total"})
+)
+`,
+	})
+	var hits byScore
+	if err := processTyped(&matchAny{}, func(found byScore) { hits = append(hits, found...) }); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"src_jobs_total", "x_src_worker_errors_total"}
+	if got := names(hits); !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if hits[0].path != filepath.Join("svc", "svc.go") || hits[0].kind != counter {
+		t.Errorf("got a %v in %s, want a Counter in svc/svc.go", hits[0].kind, hits[0].path)
+	}
+}
+
+func TestTypedLoadErrors(t *testing.T) {
+	writeModule(t, map[string]string{
+		"client_golang/prometheus/prometheus.go": forkedClient,
+		"svc/svc.go": `package svc
+
+import "example.com/m/client_golang/prometheus"
+
+var a = prometheus.NewCounter(prometheus.CounterOpts{Name: undefinedName})
+`,
+	})
+	var hits byScore
+	if err := processTyped(&matchAny{}, func(found byScore) { hits = append(hits, found...) }); err == nil {
+		t.Errorf("processTyped succeeded with %v, want the type error", names(hits))
+	}
+}
+
+func TestTypedIncludeTests(t *testing.T) {
+	setFlag(t, includeTestsFlag, true)
+	writeModule(t, map[string]string{
+		"client_golang/prometheus/prometheus.go": forkedClient,
+		"svc/svc.go": `package svc
+
+import "example.com/m/client_golang/prometheus"
+
+var jobs = prometheus.NewCounter(prometheus.CounterOpts{Name: "jobs_total"})
+`,
+		"svc/svc_test.go": `package svc
+
+import "example.com/m/client_golang/prometheus"
+
+var fixture = prometheus.NewCounter(prometheus.CounterOpts{Name: "fixture_total"})
+`,
+	})
+	var hits byScore
+	if err := processTyped(&matchAny{}, func(found byScore) { hits = append(hits, found...) }); err != nil {
+		t.Fatal(err)
+	}
+	tests := make(map[string]bool)
+	for _, hit := range hits {
+		tests[hit.val] = hit.test
+	}
+	want := map[string]bool{"jobs_total": false, "fixture_total": true}
+	if len(hits) != len(want) || !maps.Equal(tests, want) {
+		t.Errorf("got %v with test set for %v, want each of %v once", names(hits), tests, want)
+	}
+}
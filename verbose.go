@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// printVerbose prints everything known about a hit, in a block of
+// "field: value" lines under its location. The fields are always in the
+// same order and the unknown ones are left out, so that the blocks of
+// two runs can be diffed. With -C, the source follows.
+func printVerbose(hit matchResult) {
+	location := fmt.Sprintf("%s:%d", hit.path, hit.line)
+	if *columnFlag {
+		location += fmt.Sprintf(":%d", max(hit.column, 1))
+	}
+	fmt.Println(colorize(dim, location))
+
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Printf("    %-13s %s\n", name+":", value)
+		}
+	}
+	field("name", colorName(hit))
+	if hit.dynamic {
+		field("name from", hit.nameExpr)
+	}
+	field("declared as", hit.declaredName)
+	field("kind", colorize(kindColors[hit.kind], hit.kind.String()))
+	if !hit.listed {
+		field("score", strconv.Itoa(hit.score))
+	}
+	field("query", hit.query)
+	field("namespace", hit.opts["Namespace"])
+	field("subsystem", hit.opts["Subsystem"])
+	if hit.opts["Namespace"] != "" || hit.opts["Subsystem"] != "" {
+		field("short name", hit.opts["Name"])
+	}
+	labels := strings.Join(hit.labels, ", ")
+	if hit.labelsExpr != "" {
+		labels = hit.labelsExpr
+	}
+	field("labels", labels)
+	var constLabels []string
+	for _, k := range sortedKeys(hit.constLabels) {
+		constLabels = append(constLabels, k+"="+strconv.Quote(hit.constLabels[k]))
+	}
+	field("const labels", strings.Join(constLabels, ", "))
+
+	if hit.kind == histogram {
+		buckets, def := histogramBuckets(hit)
+		switch {
+		case def:
+			field("buckets", fmt.Sprintf("%v (default)", buckets))
+		case buckets != nil:
+			field("buckets", fmt.Sprint(buckets))
+		default:
+			field("buckets", hit.bucketsExpr)
+		}
+		field("native", nativeHistogramSettings(hit.opts))
+	}
+	if hit.kind == summary {
+		var objectives []string
+		for _, q := range sortedFloats(hit.objectives) {
+			objectives = append(objectives, fmt.Sprintf("%v: %v", q, hit.objectives[q]))
+		}
+		if hit.objectives == nil {
+			objectives = append(objectives, hit.objectivesExpr)
+		}
+		field("objectives", strings.Join(objectives, ", "))
+		field("max age", hit.maxAge)
+		field("age buckets", hit.opts["AgeBuckets"])
+	}
+
+	help := strings.ReplaceAll(strings.TrimSpace(hit.help), "\n", "\n"+strings.Repeat(" ", 18))
+	if help == "" && hit.kind != collector {
+		help = "(none)"
+	}
+	field("help", help)
+	if stability := hit.opts["StabilityLevel"]; stability != "" {
+		field("stability", stability[strings.LastIndex(stability, ".")+1:])
+	}
+	field("deprecated", hit.opts["DeprecatedVersion"])
+
+	field("variable", hit.varName)
+	if hit.fieldName != "" {
+		field("field", strings.TrimPrefix(hit.structType+"."+hit.fieldName, "."))
+	}
+	field("function", hit.funcName)
+	field("context", hit.declKind)
+	if hit.test {
+		field("test", "yes")
+	}
+	if hit.kind != desc && hit.kind != recordingRule {
+		field("registered", formatRegistrations(hit.registrations))
+	}
+	field("derived from", hit.derivedFrom)
+	if hit.series != "" {
+		field("note", fmt.Sprintf("query is its %s series", hit.series))
+	}
+	if hit.ruleQuery {
+		field("note", "query looks like a recording rule derived from it")
+	}
+	if *contextFlag > 0 {
+		printSource(hit, *contextFlag)
+	} else {
+		fmt.Println()
+	}
+}
+
+// sortedFloats returns the keys of a map of floats in order.
+func sortedFloats(m map[float64]float64) []float64 {
+	keys := make([]float64, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Float64s(keys)
+	return keys
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestPrintVerbose(t *testing.T) {
+	src := `package m
+
+import "github.com/prometheus/client_golang/prometheus"
+
+func newMetrics() {
+	fetchDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   "src",
+		Subsystem:   "gitserver",
+		Name:        "fetch_duration_seconds",
+		Help:        "Time spent fetching.",
+		ConstLabels: prometheus.Labels{"app": "gitserver"},
+		Buckets:     []float64{0.1, 1, 10},
+	}, []string{"op", "repo"})
+	prometheus.MustRegister(fetchDuration)
+}
+`
+	// The registrations keep the paths they are scanned with.
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("m.go", []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var hits byScore
+	if err := processDir(".", &matchAny{}, &hits); err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 {
+		t.Fatalf("got %v, want [src_gitserver_fetch_duration_seconds]", names(hits))
+	}
+	out := captureStdout(t, func() { printVerbose(hits[0]) })
+	want := `m.go:6
+    name:         src_gitserver_fetch_duration_seconds
+    kind:         Histogram
+    namespace:    src
+    subsystem:    gitserver
+    short name:   fetch_duration_seconds
+    labels:       op, repo
+    const labels: app="gitserver"
+    buckets:      [0.1 1 10]
+    help:         Time spent fetching.
+    variable:     fetchDuration
+    function:     newMetrics
+    context:      func newMetrics
+    registered:   m.go:14
+
+`
+	if out != want {
+		t.Errorf("printed\n%s\nwant\n%s", out, want)
+	}
+}
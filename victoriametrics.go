@@ -0,0 +1,78 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// vmConstructors are the functions of github.com/VictoriaMetrics/metrics
+// creating a metric from a series such as `requests_total{path="/api"}`.
+var vmConstructors = map[string]metricKind{
+	"vmmetrics.NewCounter":              counter,
+	"vmmetrics.NewFloatCounter":         counter,
+	"vmmetrics.NewGauge":                gauge,
+	"vmmetrics.NewHistogram":            histogram,
+	"vmmetrics.NewSummary":              summary,
+	"vmmetrics.GetOrCreateCounter":      counter,
+	"vmmetrics.GetOrCreateFloatCounter": counter,
+	"vmmetrics.GetOrCreateGauge":        gauge,
+	"vmmetrics.GetOrCreateHistogram":    histogram,
+	"vmmetrics.GetOrCreateSummary":      summary,
+}
+
+// inspectVictoriaMetrics reports the metric created by a VictoriaMetrics
+// constructor. Its labels are part of the series string and are reported
+// as const labels.
+func inspectVictoriaMetrics(kind metricKind, callExpr *ast.CallExpr, pos token.Position, fi *fileInfo, mr matcher, accum *byScore) {
+	if len(callExpr.Args) == 0 {
+		return
+	}
+	series, _ := evalString(callExpr.Args[0], fi)
+	name, labels := parseSeries(series)
+
+	opts := promOpts{"Name": name}
+	hit, ok := mr.Match(opts, pos)
+	if !ok {
+		return
+	}
+	hit.kind = kind
+	hit.opts = opts
+	hit.constLabels = labels
+	hit.registrations = []registration{{path: pos.Filename, line: pos.Line, registry: "default", auto: "VictoriaMetrics"}}
+	*accum = append(*accum, hit)
+}
+
+// parseSeries splits a series such as `name{a="b",c="d"}` into its name
+// and labels. Label values that cannot be decoded are kept as written.
+func parseSeries(series string) (string, map[string]string) {
+	i := strings.IndexByte(series, '{')
+	if i < 0 || !strings.HasSuffix(series, "}") {
+		return series, nil
+	}
+	name, rest := series[:i], series[i+1:len(series)-1]
+
+	labels := make(map[string]string)
+	for rest != "" {
+		eq := strings.IndexByte(rest, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.TrimSpace(rest[:eq])
+		rest = strings.TrimSpace(rest[eq+1:])
+
+		value := rest
+		if quoted, err := strconv.QuotedPrefix(rest); err == nil {
+			value, _ = strconv.Unquote(quoted)
+			rest = rest[len(quoted):]
+		} else if j := strings.IndexByte(rest, ','); j >= 0 {
+			value, rest = rest[:j], rest[j:]
+		} else {
+			rest = ""
+		}
+		labels[key] = value
+		rest = strings.TrimPrefix(strings.TrimSpace(rest), ",")
+	}
+	return name, labels
+}
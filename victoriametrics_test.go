@@ -0,0 +1,61 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVictoriaMetrics(t *testing.T) {
+	hits := scanOne(t, "package m\n\nimport \"github.com/VictoriaMetrics/metrics\"\n\n"+
+		"var (\n"+
+		"\trequests = metrics.GetOrCreateCounter(`vm_requests_total{path=\"/api\",code=\"200\"}`)\n"+
+		"\tinflight = metrics.NewGauge(\"vm_inflight\", nil)\n"+
+		"\tlatency  = metrics.GetOrCreateHistogram(`vm_latency_seconds`)\n"+
+		")\n")
+	want := []struct {
+		name   string
+		kind   metricKind
+		labels map[string]string
+	}{
+		{"vm_requests_total", counter, map[string]string{"path": "/api", "code": "200"}},
+		{"vm_inflight", gauge, nil},
+		{"vm_latency_seconds", histogram, nil},
+	}
+	if len(hits) != len(want) {
+		t.Fatalf("got %v, want %d metrics", names(hits), len(want))
+	}
+	for i, w := range want {
+		hit := hits[i]
+		if hit.val != w.name || hit.kind != w.kind || !reflect.DeepEqual(hit.constLabels, w.labels) {
+			t.Errorf("got %s %v %v, want %s %v %v", hit.val, hit.kind, hit.constLabels, w.name, w.kind, w.labels)
+		}
+		if got := formatRegistrations(hit.registrations); got != "VictoriaMetrics" {
+			t.Errorf("%s registered %s, want VictoriaMetrics", hit.val, got)
+		}
+	}
+
+	scored := scanSource(t, map[string]string{"m.go": "package m\n\nimport \"github.com/VictoriaMetrics/metrics\"\n\n" +
+		"var requests = metrics.GetOrCreateCounter(`vm_requests_total{path=\"/api\"}`)\n"}, &matchName{name: "vm_requests_total"})
+	if len(scored) != 1 || scored[0].score != 100 {
+		t.Errorf("vm_requests_total found %v, want it with score 100", names(scored))
+	}
+}
+
+func TestParseSeries(t *testing.T) {
+	for _, tt := range []struct {
+		series string
+		name   string
+		labels map[string]string
+	}{
+		{"requests_total", "requests_total", nil},
+		{`requests_total{path="/api"}`, "requests_total", map[string]string{"path": "/api"}},
+		{`requests_total{path="/a,b", code="5\"00"}`, "requests_total", map[string]string{"path": "/a,b", "code": `5"00`}},
+		{`requests_total{path=unquoted,code="200"}`, "requests_total", map[string]string{"path": "unquoted", "code": "200"}},
+		{`requests_total{`, `requests_total{`, nil},
+	} {
+		name, labels := parseSeries(tt.series)
+		if name != tt.name || !reflect.DeepEqual(labels, tt.labels) {
+			t.Errorf("parseSeries(%q) = %q, %v, want %q, %v", tt.series, name, labels, tt.name, tt.labels)
+		}
+	}
+}
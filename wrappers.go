@@ -0,0 +1,74 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+// wrapperFamily describes a wrapper constructor that declares several
+// metrics at once, with names derived from its arguments.
+type wrapperFamily struct {
+	// params names the leading string arguments of the constructor. They
+	// are substituted for {param} in the metric templates.
+	params  []string
+	metrics []wrapperMetric
+}
+
+type wrapperMetric struct {
+	name    string
+	help    string
+	kind    metricKind
+	labels  []string
+	buckets []float64
+}
+
+// wrapperFamilies are the known wrapper constructors, keyed like
+// constructors.
+var wrapperFamilies = map[string]wrapperFamily{
+	// github.com/sourcegraph/sourcegraph/internal/metrics
+	"metrics.NewRequestMeter": {
+		params: []string{"subsystem", "help"},
+		metrics: []wrapperMetric{
+			{
+				name:   "src_{subsystem}_requests_total",
+				help:   "{help}",
+				kind:   counter,
+				labels: []string{"category", "code", "host"},
+			},
+			{
+				name:    "src_{subsystem}_request_duration_seconds",
+				help:    "Time (in seconds) spent on request.",
+				kind:    histogram,
+				labels:  []string{"category", "code", "host"},
+				buckets: defBuckets,
+			},
+		},
+	},
+}
+
+// inspectWrapper reports every metric a wrapper constructor call declares.
+func inspectWrapper(family wrapperFamily, callExpr *ast.CallExpr, pos token.Position, fi *fileInfo, mr matcher, accum *byScore) {
+	var replacements []string
+	for i, param := range family.params {
+		val := "?"
+		if i < len(callExpr.Args) {
+			val, _ = evalString(callExpr.Args[i], fi)
+		}
+		replacements = append(replacements, "{"+param+"}", val)
+	}
+	r := strings.NewReplacer(replacements...)
+
+	for _, m := range family.metrics {
+		opts := promOpts{"Name": r.Replace(m.name), "Help": r.Replace(m.help)}
+		hit, ok := mr.Match(opts, pos)
+		if !ok {
+			continue
+		}
+		hit.kind = m.kind
+		hit.opts = opts
+		hit.labels = m.labels
+		hit.buckets = m.buckets
+		*accum = append(*accum, hit)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRequestMeter(t *testing.T) {
+	src := `package m
+
+import "github.com/sourcegraph/sourcegraph/internal/metrics"
+
+var (
+	meter   = metrics.NewRequestMeter("gitserver", "Total number of requests sent to gitserver.")
+	dynamic = metrics.NewRequestMeter(subsystem, "Requests.")
+)
+`
+	hits := scanOne(t, src)
+	want := []string{
+		"src_gitserver_requests_total",
+		"src_gitserver_request_duration_seconds",
+		"src_<subsystem>_requests_total",
+		"src_<subsystem>_request_duration_seconds",
+	}
+	if got := names(hits); !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if hits[0].kind != counter || hits[0].help != "Total number of requests sent to gitserver." {
+		t.Errorf("got a %v with help %q, want the Counter with the help argument", hits[0].kind, hits[0].help)
+	}
+	if hits[1].kind != histogram || !slices.Equal(hits[1].buckets, defBuckets) {
+		t.Errorf("got a %v with buckets %v, want the Histogram with the default buckets", hits[1].kind, hits[1].buckets)
+	}
+	for _, hit := range hits {
+		if hit.line != 6 && hit.line != 7 || !slices.Equal(hit.labels, []string{"category", "code", "host"}) {
+			t.Errorf("%s declared at line %d with labels %v, want the call site and the meter labels", hit.val, hit.line, hit.labels)
+		}
+	}
+
+	hits = scanSource(t, map[string]string{"m.go": src}, &matchName{name: "src_gitserver_request_duration_seconds"})
+	if len(hits) == 0 || hits[0].val != "src_gitserver_request_duration_seconds" || hits[0].score != 100 {
+		t.Errorf("src_gitserver_request_duration_seconds found %v, want an exact match", names(hits))
+	}
+}